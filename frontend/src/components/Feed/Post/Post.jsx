@@ -1,11 +1,13 @@
 import React from "react";
 
 import Button from "../../Button/Button";
+import Avatar from "../../Image/Avatar";
 import "./Post.css";
 
 const post = (props) => (
 	<article className="post">
 		<header className="post__header">
+			{props.avatar && <Avatar image={props.avatar} size={2} />}
 			<h3 className="post__meta">
 				Posted by {props.author} on {props.date}
 			</h3>
@@ -12,7 +12,7 @@ import useWebSocket, { ReadyState } from "react-use-websocket";
 
 interface post {
 	_id: string;
-	creator: { _id: string; name: string };
+	creator: { _id: string; name: string; avatarUrl?: string };
 	createdAt: string;
 	title: string;
 	imageUrl?: string;
@@ -91,7 +91,11 @@ const Feed = (props: { token: string | null; userId: string | null }) => {
 	);
 
 	useEffect(() => {
-		fetch("URL")
+		fetch(`${import.meta.env.VITE_API_BASE_URL}/auth/status`, {
+			headers: {
+				Authorization: `Bearer ${props.token}`,
+			},
+		})
 			.then((res) => {
 				if (res.status !== 200) {
 					throw new Error("Failed to fetch user status.");
@@ -104,12 +108,34 @@ const Feed = (props: { token: string | null; userId: string | null }) => {
 			.catch(catchError);
 
 		loadPosts();
-	}, [loadPosts]);
+	}, [loadPosts, props.token]);
 
-	const { readyState, lastJsonMessage } = useWebSocket(
-		import.meta.env.VITE_WS_URL
+	// browsers can't send the Authorization header with a websocket, so exchange the token for a ticket
+	const getSocketUrl = useCallback(
+		() =>
+			fetch(`${import.meta.env.VITE_API_BASE_URL}/auth/ws-ticket`, {
+				method: "POST",
+				headers: {
+					Authorization: `Bearer ${props.token}`,
+				},
+			})
+				.then((res) => {
+					if (res.status !== 200) {
+						throw new Error("Failed to open live updates.");
+					}
+					return res.json();
+				})
+				.then(
+					(resData: { ticket: string }) =>
+						`${import.meta.env.VITE_WS_URL}?ticket=${encodeURIComponent(resData.ticket)}`
+				),
+		[props.token]
 	);
 
+	const { readyState, lastJsonMessage } = useWebSocket(getSocketUrl, {
+		shouldReconnect: () => true,
+	});
+
 	useEffect(() => {
 		console.log("socket Message", lastJsonMessage);
 		const data = lastJsonMessage as { action: string; post: post };
@@ -176,7 +202,14 @@ const Feed = (props: { token: string | null; userId: string | null }) => {
 
 	const statusUpdateHandler = (event: React.FormEvent<HTMLFormElement>) => {
 		event.preventDefault();
-		fetch("URL")
+		fetch(`${import.meta.env.VITE_API_BASE_URL}/auth/status`, {
+			method: "PATCH",
+			headers: {
+				Authorization: `Bearer ${props.token}`,
+				"Content-Type": "application/json",
+			},
+			body: JSON.stringify({ status: state.status }),
+		})
 			.then((res) => {
 				if (res.status !== 200 && res.status !== 201) {
 					throw new Error("Can't update status!");
@@ -387,6 +420,10 @@ const Feed = (props: { token: string | null; userId: string | null }) => {
 									key={post._id}
 									id={post._id}
 									author={post.creator.name}
+									avatar={
+										post.creator.avatarUrl &&
+										`${import.meta.env.VITE_API_BASE_URL}/${post.creator.avatarUrl}`
+									}
 									date={new Date(
 										post.createdAt
 									).toLocaleDateString("en-US")}
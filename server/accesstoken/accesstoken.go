@@ -0,0 +1,182 @@
+package accesstoken
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Jesuloba-world/social-sum/server/database"
+)
+
+// Prefix marks a bearer token as a personal access token rather than a JWT.
+const Prefix = "ssp_"
+
+// lastUsedInterval limits how often a token's LastUsedAt is written.
+const lastUsedInterval = time.Minute
+
+type Scope string
+
+const (
+	ScopeFeedRead  Scope = "feed:read"
+	ScopeFeedWrite Scope = "feed:write"
+)
+
+var ErrInvalid = errors.New("access token is invalid, expired or revoked")
+
+// Token is a long-lived credential for scripts and integrations.
+// Only a hash of the secret is stored; the secret itself is shown once, on creation.
+type Token struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	UserID     primitive.ObjectID `bson:"userId" json:"userId"`
+	Name       string             `bson:"name" json:"name"`
+	Scopes     []Scope            `bson:"scopes" json:"scopes"`
+	Hash       string             `bson:"hash" json:"-"`
+	Hint       string             `bson:"hint" json:"hint"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	ExpiresAt  time.Time          `bson:"expiresAt" json:"expiresAt"`
+	LastUsedAt *time.Time         `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+}
+
+func (t *Token) HasScope(scope Scope) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func collection() *mongo.Collection {
+	return database.Client.Database("Auth").Collection("AccessToken")
+}
+
+// EnsureIndexes creates the unique hash index and lets mongo remove tokens once they expire.
+func EnsureIndexes() error {
+	_, err := collection().Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.M{"hash": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"userId": 1}},
+		{Keys: bson.M{"expiresAt": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create stores a new token and returns it along with its secret, which can't be recovered later.
+func Create(userId primitive.ObjectID, name string, scopes []Scope, expiresAt time.Time) (string, *Token, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	secret := Prefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	token := &Token{
+		UserID:    userId,
+		Name:      name,
+		Scopes:    scopes,
+		Hash:      hash(secret),
+		Hint:      secret[len(secret)-4:],
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+
+	result, err := collection().InsertOne(context.TODO(), token)
+	if err != nil {
+		return "", nil, err
+	}
+
+	token.ID = result.InsertedID.(primitive.ObjectID)
+	return secret, token, nil
+}
+
+// Authenticate looks up an unexpired token by its secret and records its use.
+func Authenticate(secret string) (*Token, error) {
+	if !strings.HasPrefix(secret, Prefix) {
+		return nil, ErrInvalid
+	}
+
+	now := time.Now()
+
+	token := new(Token)
+	err := collection().FindOne(context.TODO(), bson.M{"hash": hash(secret), "expiresAt": bson.M{"$gt": now}}).Decode(token)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInvalid
+		}
+		return nil, err
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > lastUsedInterval {
+		token.LastUsedAt = &now
+		_, err = collection().UpdateOne(context.TODO(), bson.M{"_id": token.ID}, bson.M{"$set": bson.M{"lastUsedAt": now}})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return token, nil
+}
+
+// List returns the user's tokens, newest first.
+func List(userId primitive.ObjectID) ([]Token, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	cursor, err := collection().Find(context.TODO(), bson.M{"userId": userId}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	tokens := []Token{}
+	if err := cursor.All(context.TODO(), &tokens); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Revoke deletes one of the user's tokens. It reports false if there was no such token.
+func Revoke(userId, tokenId primitive.ObjectID) (bool, error) {
+	result, err := collection().DeleteOne(context.TODO(), bson.M{"_id": tokenId, "userId": userId})
+	if err != nil {
+		return false, err
+	}
+
+	return result.DeletedCount > 0, nil
+}
+
+// Active returns which of the given tokens still exist and have not expired.
+func Active(tokenIds []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	filter := bson.M{"_id": bson.M{"$in": tokenIds}, "expiresAt": bson.M{"$gt": time.Now()}}
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+
+	cursor, err := collection().Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	tokens := []Token{}
+	if err := cursor.All(context.TODO(), &tokens); err != nil {
+		return nil, err
+	}
+
+	active := make(map[primitive.ObjectID]bool, len(tokens))
+	for _, token := range tokens {
+		active[token.ID] = true
+	}
+	return active, nil
+}
@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Jesuloba-world/social-sum/server/database"
+	"github.com/Jesuloba-world/social-sum/server/rbac"
+)
+
+// Entry records a privileged action, i.e. one a user could only perform because of their role.
+type Entry struct {
+	ID         primitive.ObjectID     `bson:"_id,omitempty" json:"_id"`
+	ActorID    primitive.ObjectID     `bson:"actorId" json:"actorId"`
+	ActorRole  rbac.Role              `bson:"actorRole" json:"actorRole"`
+	Action     string                 `bson:"action" json:"action"`
+	TargetType string                 `bson:"targetType" json:"targetType"`
+	TargetID   primitive.ObjectID     `bson:"targetId,omitempty" json:"targetId,omitempty"`
+	Details    map[string]interface{} `bson:"details,omitempty" json:"details,omitempty"`
+	IP         string                 `bson:"ip" json:"ip"`
+	CreatedAt  time.Time              `bson:"createdAt" json:"createdAt"`
+}
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+func collection() *mongo.Collection {
+	return database.Client.Database("Auth").Collection("AuditLog")
+}
+
+func Record(entry Entry) error {
+	entry.CreatedAt = time.Now()
+
+	_, err := collection().InsertOne(context.TODO(), entry)
+	return err
+}
+
+// List returns audit entries, newest first, along with the total number of entries. Pages start at 1.
+func List(page, limit int) ([]Entry, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	skip := (page - 1) * limit
+
+	opts := options.Find().SetLimit(int64(limit)).SetSkip(int64(skip)).SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	cursor, err := collection().Find(context.TODO(), bson.M{}, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(context.TODO())
+
+	entries := []Entry{}
+	if err := cursor.All(context.TODO(), &entries); err != nil {
+		return nil, 0, err
+	}
+
+	total, err := collection().CountDocuments(context.TODO(), bson.M{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
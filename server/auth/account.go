@@ -0,0 +1,360 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Jesuloba-world/social-sum/server/database"
+	"github.com/Jesuloba-world/social-sum/server/mailer"
+	"github.com/Jesuloba-world/social-sum/server/session"
+)
+
+const emailChangeExpiry = 24 * time.Hour
+
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidEmailChange = errors.New("email confirmation link is invalid or has expired")
+)
+
+// UserUpdate describes a change to a user's public details.
+type UserUpdate struct {
+	User User
+	// Changed lists the json names of the fields that changed, e.g. "name" or "status".
+	Changed []string
+}
+
+var userUpdateListeners []func(UserUpdate)
+
+// OnUserUpdate registers a listener that is called after a user's public details,
+// such as their name, change. Listeners run synchronously and must not block.
+func OnUserUpdate(listener func(UserUpdate)) {
+	userUpdateListeners = append(userUpdateListeners, listener)
+}
+
+func notifyUserUpdate(user User, changed ...string) {
+	for _, listener := range userUpdateListeners {
+		listener(UserUpdate{User: user, Changed: changed})
+	}
+}
+
+// FindUser returns the user with the given id, or ErrUserNotFound.
+func FindUser(userId primitive.ObjectID) (*User, error) {
+	userCollection := database.Client.Database("Auth").Collection("User")
+
+	user := new(User)
+	err := userCollection.FindOne(context.TODO(), bson.M{"_id": userId}).Decode(user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// FindUsers loads the users with the given ids, in the same order. Ids without a user are skipped.
+func FindUsers(userIds []primitive.ObjectID) ([]User, error) {
+	userCollection := database.Client.Database("Auth").Collection("User")
+
+	cursor, err := userCollection.Find(context.TODO(), bson.M{"_id": bson.M{"$in": userIds}})
+	if err != nil {
+		return nil, err
+	}
+
+	var found []User
+	if err := cursor.All(context.TODO(), &found); err != nil {
+		return nil, err
+	}
+
+	byId := make(map[primitive.ObjectID]User, len(found))
+	for _, user := range found {
+		byId[user.ID] = user
+	}
+
+	users := make([]User, 0, len(found))
+	for _, id := range userIds {
+		if user, ok := byId[id]; ok {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+// nameCollation compares names ignoring case.
+var nameCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// FindUsersByName loads the users whose name is one of names, ignoring case. Names aren't
+// unique, so a name can match several users.
+func FindUsersByName(names []string) ([]User, error) {
+	userCollection := database.Client.Database("Auth").Collection("User")
+
+	opts := options.Find().SetCollation(nameCollation).SetProjection(bson.M{"_id": 1, "name": 1})
+	cursor, err := userCollection.Find(context.TODO(), bson.M{"name": bson.M{"$in": names}}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	users := []User{}
+	if err := cursor.All(context.TODO(), &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// ChangePassword replaces the user's password after checking the current one,
+// then logs the user out of every session except keepSessionId.
+func ChangePassword(userId, keepSessionId primitive.ObjectID, input ChangePasswordInput) error {
+	if err := Validator.Struct(input); err != nil {
+		return toFieldErrors(err)
+	}
+
+	user, err := FindUser(userId)
+	if err != nil {
+		return err
+	}
+
+	match, err := checkPassword(user, input.CurrentPassword)
+	if err != nil {
+		return err
+	}
+	if !match {
+		return FieldErrors{"currentPassword": "is incorrect"}
+	}
+
+	if err := ValidatePassword("newPassword", input.NewPassword, user.Email, user.Name); err != nil {
+		return err
+	}
+
+	hashedPassword, err := HashPassword(input.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	user.SetTimestamps()
+
+	userCollection := database.Client.Database("Auth").Collection("User")
+	update := bson.M{
+		"$set": bson.M{
+			"password":  hashedPassword,
+			"updatedAt": user.UpdatedAt,
+		},
+	}
+
+	_, err = userCollection.UpdateOne(context.TODO(), bson.M{"_id": user.ID}, update)
+	if err != nil {
+		return err
+	}
+
+	_, err = session.RevokeOthers(user.ID, keepSessionId)
+	return err
+}
+
+// RequestEmailChange emails a confirmation link to the new address.
+// The email only changes once the link is followed, see ConfirmEmailChange.
+func RequestEmailChange(userId primitive.ObjectID, input ChangeEmailInput) error {
+	if err := Validator.Struct(input); err != nil {
+		return toFieldErrors(err)
+	}
+
+	user, err := FindUser(userId)
+	if err != nil {
+		return err
+	}
+
+	match, err := checkPassword(user, input.Password)
+	if err != nil {
+		return err
+	}
+	if !match {
+		return FieldErrors{"password": "is incorrect"}
+	}
+
+	if input.NewEmail == user.Email {
+		return FieldErrors{"newEmail": "is already your email"}
+	}
+
+	taken, err := emailTaken(input.NewEmail)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return FieldErrors{"newEmail": "is already registered"}
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	change := EmailChange{
+		UserID:    user.ID,
+		NewEmail:  input.NewEmail,
+		TokenHash: hashToken(token),
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(emailChangeExpiry),
+	}
+
+	emailChangeCollection := database.Client.Database("Auth").Collection("EmailChange")
+
+	// a new request replaces any pending one
+	_, err = emailChangeCollection.DeleteMany(context.TODO(), bson.M{"userId": user.ID})
+	if err != nil {
+		return err
+	}
+
+	_, err = emailChangeCollection.InsertOne(context.TODO(), change)
+	if err != nil {
+		return err
+	}
+
+	link := mailer.Link("/auth/email/confirm?token=" + url.QueryEscape(token))
+	err = mailer.Send(input.NewEmail, "Confirm your new email address", fmt.Sprintf(
+		"Hi %s,\n\nFollow this link within 24 hours to use this address for your Social sum account:\n\n%s\n\nIf you did not ask for this, you can ignore this email.",
+		user.Name, link,
+	))
+	if err != nil {
+		return err
+	}
+
+	// let the current address know, in case the account has been taken over
+	err = mailer.Send(user.Email, "Your email address is being changed", fmt.Sprintf(
+		"Hi %s,\n\nA change of your Social sum email address to %s was requested. If this wasn't you, change your password now.",
+		user.Name, input.NewEmail,
+	))
+	if err != nil {
+		slog.Error(fmt.Sprintf("could not notify %s of email change: %s", user.Email, err.Error()))
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange applies the email change the token was issued for. Tokens can only be used once.
+func ConfirmEmailChange(token string) (*User, error) {
+	emailChangeCollection := database.Client.Database("Auth").Collection("EmailChange")
+
+	change := new(EmailChange)
+	filter := bson.M{"tokenHash": hashToken(token), "expiresAt": bson.M{"$gt": time.Now()}}
+	err := emailChangeCollection.FindOneAndDelete(context.TODO(), filter).Decode(change)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInvalidEmailChange
+		}
+		return nil, err
+	}
+
+	taken, err := emailTaken(change.NewEmail)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, FieldErrors{"newEmail": "is already registered"}
+	}
+
+	userCollection := database.Client.Database("Auth").Collection("User")
+	update := bson.M{
+		"$set": bson.M{
+			"email":     change.NewEmail,
+			"updatedAt": time.Now(),
+		},
+	}
+
+	user := new(User)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = userCollection.FindOneAndUpdate(context.TODO(), bson.M{"_id": change.UserID}, update, opts).Decode(user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// UpdateName changes the user's display name and notifies OnUserUpdate listeners.
+func UpdateName(userId primitive.ObjectID, input UpdateNameInput) (*User, error) {
+	if err := Validator.Struct(input); err != nil {
+		return nil, toFieldErrors(err)
+	}
+
+	userCollection := database.Client.Database("Auth").Collection("User")
+	update := bson.M{
+		"$set": bson.M{
+			"name":      input.Name,
+			"updatedAt": time.Now(),
+		},
+	}
+
+	user := new(User)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := userCollection.FindOneAndUpdate(context.TODO(), bson.M{"_id": userId}, update, opts).Decode(user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	notifyUserUpdate(*user, "name")
+
+	return user, nil
+}
+
+// UpdateStatus changes the user's status and notifies OnUserUpdate listeners.
+func UpdateStatus(userId primitive.ObjectID, input UpdateStatusInput) (*User, error) {
+	input.Status = strings.TrimSpace(input.Status)
+
+	if err := Validator.Struct(input); err != nil {
+		return nil, toFieldErrors(err)
+	}
+
+	userCollection := database.Client.Database("Auth").Collection("User")
+	update := bson.M{
+		"$set": bson.M{
+			"status":    input.Status,
+			"updatedAt": time.Now(),
+		},
+	}
+
+	user := new(User)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := userCollection.FindOneAndUpdate(context.TODO(), bson.M{"_id": userId}, update, opts).Decode(user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	notifyUserUpdate(*user, "status")
+
+	return user, nil
+}
+
+func emailTaken(email string) (bool, error) {
+	userCollection := database.Client.Database("Auth").Collection("User")
+
+	count, err := userCollection.CountDocuments(context.TODO(), bson.M{"email": email})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
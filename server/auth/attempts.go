@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Jesuloba-world/social-sum/server/database"
+)
+
+// attemptRecord holds the failed login attempts for one key.
+// Keys are namespaced, e.g. "email:jane@example.com" or "ip:10.0.0.1".
+type attemptRecord struct {
+	Key         string    `bson:"_id"`
+	Failures    int       `bson:"failures"`
+	LastFailure time.Time `bson:"lastFailure"`
+	LockedUntil time.Time `bson:"lockedUntil"`
+	ExpiresAt   time.Time `bson:"expiresAt"`
+}
+
+// AttemptStore persists failed login attempts.
+// Records whose last failure is older than the window passed to Increment start over.
+type AttemptStore interface {
+	Get(key string) (attemptRecord, error)
+	Increment(key string, now time.Time, window time.Duration) (attemptRecord, error)
+	Lock(key string, until time.Time) error
+	Reset(key string) error
+}
+
+// attemptSweepInterval is how often the memory store drops stale records. Sweeping on
+// every failure would make a burst of failures quadratic in the number of records.
+const attemptSweepInterval = time.Minute
+
+type memoryAttemptStore struct {
+	mu        sync.Mutex
+	records   map[string]attemptRecord
+	lastSweep time.Time
+}
+
+func NewMemoryAttemptStore() AttemptStore {
+	return &memoryAttemptStore{records: make(map[string]attemptRecord)}
+}
+
+func (s *memoryAttemptStore) Get(key string) (attemptRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[key]
+	if !ok || time.Now().After(record.ExpiresAt) {
+		return attemptRecord{Key: key}, nil
+	}
+	return record, nil
+}
+
+func (s *memoryAttemptStore) Increment(key string, now time.Time, window time.Duration) (attemptRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[key]
+	if !ok || now.Sub(record.LastFailure) > window {
+		record = attemptRecord{Key: key}
+	}
+
+	record.Failures++
+	record.LastFailure = now
+	record.ExpiresAt = now.Add(window)
+	s.records[key] = record
+
+	// drop stale records so the map does not grow with every address that ever failed
+	if now.Sub(s.lastSweep) >= attemptSweepInterval {
+		s.lastSweep = now
+		for k, r := range s.records {
+			if now.After(r.ExpiresAt) && now.After(r.LockedUntil) {
+				delete(s.records, k)
+			}
+		}
+	}
+
+	return record, nil
+}
+
+func (s *memoryAttemptStore) Lock(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := s.records[key]
+	record.Key = key
+	record.LockedUntil = until
+	if record.ExpiresAt.Before(until) {
+		record.ExpiresAt = until
+	}
+	s.records[key] = record
+
+	return nil
+}
+
+func (s *memoryAttemptStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
+
+type mongoAttemptStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoAttemptStore stores attempts in the Auth.LoginAttempt collection,
+// so lockouts are shared between server instances and survive restarts.
+func NewMongoAttemptStore() (AttemptStore, error) {
+	collection := database.Client.Database("Auth").Collection("LoginAttempt")
+
+	// let mongo remove records once they no longer count towards a lockout
+	_, err := collection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    bson.M{"expiresAt": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &mongoAttemptStore{collection: collection}, nil
+}
+
+func (s *mongoAttemptStore) Get(key string) (attemptRecord, error) {
+	record := attemptRecord{Key: key}
+
+	err := s.collection.FindOne(context.TODO(), bson.M{"_id": key, "expiresAt": bson.M{"$gt": time.Now()}}).Decode(&record)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return record, err
+	}
+	return record, nil
+}
+
+func (s *mongoAttemptStore) Increment(key string, now time.Time, window time.Duration) (attemptRecord, error) {
+	// a pipeline update keeps the window check and the increment atomic
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"failures": bson.M{"$cond": bson.A{
+				bson.M{"$lt": bson.A{"$lastFailure", now.Add(-window)}},
+				1,
+				bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failures", 0}}, 1}},
+			}},
+			"lastFailure": now,
+			"lockedUntil": bson.M{"$ifNull": bson.A{"$lockedUntil", time.Time{}}},
+			"expiresAt": bson.M{"$max": bson.A{
+				now.Add(window),
+				bson.M{"$ifNull": bson.A{"$lockedUntil", time.Time{}}},
+			}},
+		}}},
+	}
+
+	record := attemptRecord{}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := s.collection.FindOneAndUpdate(context.TODO(), bson.M{"_id": key}, update, opts).Decode(&record)
+	return record, err
+}
+
+func (s *mongoAttemptStore) Lock(key string, until time.Time) error {
+	update := bson.M{
+		"$set": bson.M{"lockedUntil": until},
+		"$max": bson.M{"expiresAt": until},
+	}
+
+	_, err := s.collection.UpdateOne(context.TODO(), bson.M{"_id": key}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (s *mongoAttemptStore) Reset(key string) error {
+	_, err := s.collection.DeleteOne(context.TODO(), bson.M{"_id": key})
+	return err
+}
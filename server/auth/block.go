@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Jesuloba-world/social-sum/server/database"
+)
+
+// maxListSize caps the block and mute lists, which are stored on the user document.
+const maxListSize = 1000
+
+var (
+	ErrSelfBlock = errors.New("users cannot block or mute themselves")
+	ErrListFull  = errors.New("block and mute lists are limited to 1000 users")
+)
+
+// HasBlocked reports whether the user blocked userId.
+func (u *User) HasBlocked(userId primitive.ObjectID) bool {
+	return slices.Contains(u.Blocked, userId)
+}
+
+// Hides reports whether posts by userId are hidden from the user, because the user blocked or muted them.
+func (u *User) Hides(userId primitive.ObjectID) bool {
+	return slices.Contains(u.Blocked, userId) || slices.Contains(u.Muted, userId)
+}
+
+func BlockUser(userId, targetId primitive.ObjectID) (*User, error) {
+	return addToList(userId, targetId, "blocked")
+}
+
+func UnblockUser(userId, targetId primitive.ObjectID) (*User, error) {
+	return removeFromList(userId, targetId, "blocked")
+}
+
+func MuteUser(userId, targetId primitive.ObjectID) (*User, error) {
+	return addToList(userId, targetId, "muted")
+}
+
+func UnmuteUser(userId, targetId primitive.ObjectID) (*User, error) {
+	return removeFromList(userId, targetId, "muted")
+}
+
+func addToList(userId, targetId primitive.ObjectID, list string) (*User, error) {
+	if userId == targetId {
+		return nil, ErrSelfBlock
+	}
+
+	userCollection := database.Client.Database("Auth").Collection("User")
+
+	// adding someone already listed is allowed on a full list, $addToSet makes it a no-op
+	filter := bson.M{"_id": userId, "$or": bson.A{
+		bson.M{fmt.Sprintf("%s.%d", list, maxListSize-1): bson.M{"$exists": false}},
+		bson.M{list: targetId},
+	}}
+	update := bson.M{
+		"$addToSet": bson.M{list: targetId},
+		"$set":      bson.M{"updatedAt": time.Now()},
+	}
+
+	user := new(User)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := userCollection.FindOneAndUpdate(context.TODO(), filter, update, opts).Decode(user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrListFull
+		}
+		return nil, err
+	}
+
+	notifyUserUpdate(*user, list)
+
+	return user, nil
+}
+
+func removeFromList(userId, targetId primitive.ObjectID, list string) (*User, error) {
+	userCollection := database.Client.Database("Auth").Collection("User")
+
+	update := bson.M{
+		"$pull": bson.M{list: targetId},
+		"$set":  bson.M{"updatedAt": time.Now()},
+	}
+
+	user := new(User)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := userCollection.FindOneAndUpdate(context.TODO(), bson.M{"_id": userId}, update, opts).Decode(user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	notifyUserUpdate(*user, list)
+
+	return user, nil
+}
+
+// BlockedBy returns the ids of the users who blocked userId, and whose posts it mustn't see.
+func BlockedBy(userId primitive.ObjectID) ([]primitive.ObjectID, error) {
+	userCollection := database.Client.Database("Auth").Collection("User")
+
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+	cursor, err := userCollection.Find(context.TODO(), bson.M{"blocked": userId}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []User
+	if err := cursor.All(context.TODO(), &users); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	return ids, nil
+}
@@ -1,21 +1,27 @@
 package auth
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
-	"os"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"golang.org/x/crypto/bcrypt"
 
+	"github.com/Jesuloba-world/social-sum/server/accesstoken"
+	"github.com/Jesuloba-world/social-sum/server/audit"
 	"github.com/Jesuloba-world/social-sum/server/database"
+	"github.com/Jesuloba-world/social-sum/server/middleware"
+	"github.com/Jesuloba-world/social-sum/server/passwordhash"
+	"github.com/Jesuloba-world/social-sum/server/rbac"
+	"github.com/Jesuloba-world/social-sum/server/session"
 )
 
 type userSerializer struct {
@@ -24,8 +30,30 @@ type userSerializer struct {
 }
 
 type loginSerializer struct {
-	Token  string `json:"token"`
-	UserID string `json:"userid"`
+	Token     string `json:"token"`
+	UserID    string `json:"userid"`
+	CSRFToken string `json:"csrfToken"`
+}
+
+type csrfSerializer struct {
+	CSRFToken string `json:"csrfToken"`
+}
+
+type wsTicketSerializer struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type roleSerializer struct {
+	Message string    `json:"message"`
+	UserID  string    `json:"userid"`
+	Role    rbac.Role `json:"role"`
+}
+
+type auditLogSerializer struct {
+	Message    string        `json:"message"`
+	Entries    []audit.Entry `json:"entries"`
+	TotalItems int64         `json:"totalItems"`
 }
 
 // @Summary	sign up new user
@@ -56,6 +84,7 @@ func signup(c *fiber.Ctx) error {
 		Name:     input.Name,
 		Password: hashedPassword,
 		Status:   "I am new!",
+		Role:     rbac.RoleUser,
 	}
 
 	user.SetTimestamps()
@@ -80,6 +109,8 @@ func signup(c *fiber.Ctx) error {
 // @param		loginInput	body		loginInput		true	"login Params"
 // @Success	200			{object}	loginSerializer	"Successfully logged in user"
 // @Failure	400			{string}	string			"Bad Request"
+// @Failure	401			{string}	string			"Invalid Email or password"
+// @Failure	429			{string}	string			"Too Many Requests"
 // @Failure	500			{string}	string			"Internal Server Error"
 // @Router		/auth/login [post]
 func login(c *fiber.Ctx) error {
@@ -91,48 +122,1077 @@ func login(c *fiber.Ctx) error {
 		return c.Status(http.StatusBadRequest).SendString(err.Error())
 	}
 
-	user := new(User)
+	now := time.Now()
 
-	err := userCollection.FindOne(context.TODO(), bson.M{"email": input.Email}).Decode(user)
+	lockedUntil, err := guard.lockedUntil(input.Email, c.IP())
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return c.Status(http.StatusNotFound).SendString("No user found with the provided email")
-		}
 		return c.Status(http.StatusInternalServerError).SendString(err.Error())
 	}
 
+	if lockedUntil.After(now) {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(lockedUntil.Sub(now).Seconds()))))
+		return c.Status(http.StatusTooManyRequests).SendString("Too many failed login attempts, try again later")
+	}
+
+	user := new(User)
+
+	err = userCollection.FindOne(context.TODO(), bson.M{"email": input.Email}).Decode(user)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+	userFound := err == nil
+
+	// unknown emails are checked against a dummy hash and get the same response as a wrong password
+	passwordHash := user.Password
+	if !userFound {
+		passwordHash = dummyPasswordHash()
+	}
+
 	// compare password
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password))
+	match, needsRehash, err := passwordhash.Verify(passwordHash, input.Password)
 	if err != nil {
+		slog.Error(fmt.Sprintf("could not verify password: %s", err.Error()))
+	}
+	if !match || !userFound {
+		if err := guard.recordFailure(input.Email, c.IP()); err != nil {
+			slog.Error(fmt.Sprintf("could not record failed login: %s", err.Error()))
+		}
 		return c.Status(http.StatusUnauthorized).SendString("Invalid Email or password")
 	}
 
-	// create claim
-	expirationTime := time.Now().Add(1 * time.Hour) // 1 hour
-	claim := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID.Hex(),
-		"email":   user.Email,
-		"exp":     expirationTime.Unix(),
+	if err := guard.recordSuccess(input.Email); err != nil {
+		slog.Error(fmt.Sprintf("could not reset failed logins: %s", err.Error()))
+	}
+
+	// the plain password is only available now, so this is when outdated hashes get upgraded
+	if needsRehash {
+		if err := rehashPassword(user, input.Password); err != nil {
+			slog.Error(fmt.Sprintf("could not upgrade password hash of user %s: %s", user.ID.Hex(), err.Error()))
+		}
+	}
+
+	return completeLogin(c, user)
+}
+
+// @Summary		Request a login link
+// @Description	Emails a single-use login link, valid for 15 minutes, if an account exists for the email. The link only works in the browser that requested it.
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @param			magicLinkInput	body		magicLinkInput	true	"Magic link Params"
+// @Success		202				{string}	string			"Login link sent"
+// @Failure		400				{string}	string			"Bad Request"
+// @Failure		429				{string}	string			"Too Many Requests"
+// @Failure		500				{string}	string			"Internal Server Error"
+// @Router			/auth/magic-link [post]
+func magicLink(c *fiber.Ctx) error {
+	input := new(magicLinkInput)
+
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	now := time.Now()
+
+	lockedUntil, err := guard.throttle(magicLinkKey(input.Email), magicLinkLimit)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	if lockedUntil.After(now) {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(lockedUntil.Sub(now).Seconds()))))
+		return c.Status(http.StatusTooManyRequests).SendString("Too many login links requested, try again later")
+	}
+
+	binding, err := randomToken()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	// the link is sent in the background, so neither the response time nor a mail failure
+	// tells whether the account exists
+	go func(email string) {
+		if err := sendMagicLink(email, binding); err != nil {
+			slog.Error(fmt.Sprintf("could not send login link: %s", err.Error()))
+		}
+	}(input.Email)
+
+	// set whether or not the account exists, so the response doesn't tell
+	c.Cookie(&fiber.Cookie{
+		Name:     magicLinkCookie,
+		Value:    binding,
+		Path:     "/auth/magic-link",
+		Expires:  now.Add(magicLinkExpiry),
+		HTTPOnly: true,
+		SameSite: "Lax",
+		Secure:   true,
 	})
 
-	// sign the the claim
-	token, err := claim.SignedString([]byte(os.Getenv("SECRET_KEY")))
+	return c.Status(http.StatusAccepted).SendString("If an account exists for this email, a login link has been sent to it")
+}
 
+// @Summary		Log in with a login link
+// @Description	Logs in like /auth/login with the token from a login link. Has to be opened in the browser that requested the link.
+// @Tags			Auth
+// @Produce		json
+// @Param			token	query		string			true	"Login link token"
+// @Success		200		{object}	loginSerializer	"Successfully logged in user"
+// @Failure		400		{string}	string			"Bad Request"
+// @Failure		500		{string}	string			"Internal Server Error"
+// @Router			/auth/magic-link/verify [get]
+func verifyMagicLink(c *fiber.Ctx) error {
+	user, err := redeemMagicLink(c.Query("token"), c.Cookies(magicLinkCookie))
 	if err != nil {
-		slog.Error(fmt.Sprintf("could not login: %s", err.Error()))
-		return c.Status(http.StatusInternalServerError).SendString("could not login")
+		return sendAccountError(c, err)
 	}
 
-	cookie := fiber.Cookie{
-		Name:     "jwt",
-		Value:    token,
-		Expires:  expirationTime,
+	c.Cookie(&fiber.Cookie{
+		Name:     magicLinkCookie,
+		Path:     "/auth/magic-link",
+		Expires:  time.Now().Add(-time.Hour),
 		HTTPOnly: true,
-		SameSite: "None",
+		SameSite: "Lax",
 		Secure:   true,
+	})
+
+	// following the link proves access to the inbox, which is enough to lift a password lockout
+	if err := guard.recordSuccess(user.Email); err != nil {
+		slog.Error(fmt.Sprintf("could not reset failed logins: %s", err.Error()))
+	}
+
+	return completeLogin(c, user)
+}
+
+// @Summary		Change a user's role
+// @Description	Assigns a role to a user. The change applies to tokens issued from the user's next login.
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Security		BearerAuth
+// @Param			userId			path		string				true	"User ID"
+// @Param			updateRoleInput	body		updateRoleInput		true	"Role Params"
+// @Success		200				{object}	roleSerializer		"Role updated successfully"
+// @Failure		400				{string}	string				"Bad Request"
+// @Failure		403				{string}	string				"Forbidden"
+// @Failure		404				{string}	string				"Not Found"
+// @Failure		500				{string}	string				"Internal Server Error"
+// @Router			/auth/users/{userId}/role [patch]
+func updateRole(c *fiber.Ctx) error {
+	userCollection := database.Client.Database("Auth").Collection("User")
+
+	objectId, err := primitive.ObjectIDFromHex(c.Params("userId"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).SendString("Invalid Id")
+	}
+
+	input := new(updateRoleInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	actorId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	user := new(User)
+	err = userCollection.FindOne(context.TODO(), bson.M{"_id": objectId}).Decode(user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.Status(http.StatusNotFound).SendString("User not found")
+		}
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	previousRole, _ := rbac.ParseRole(string(user.Role))
+
+	user.SetTimestamps()
+
+	update := bson.M{
+		"$set": bson.M{
+			"role":      input.Role,
+			"updatedAt": user.UpdatedAt,
+		},
+	}
+
+	_, err = userCollection.UpdateOne(context.TODO(), bson.M{"_id": user.ID}, update)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	err = audit.Record(audit.Entry{
+		ActorID:    actorId,
+		ActorRole:  middleware.GetRole(c),
+		Action:     "user.role.update",
+		TargetType: "user",
+		TargetID:   user.ID,
+		Details:    map[string]interface{}{"from": previousRole, "to": input.Role},
+		IP:         c.IP(),
+	})
+	if err != nil {
+		slog.Error(fmt.Sprintf("could not record role change for user %s: %s", user.ID.Hex(), err.Error()))
+	}
+
+	return c.Status(http.StatusOK).JSON(roleSerializer{Message: "Role updated successfully", UserID: user.ID.Hex(), Role: input.Role})
+}
+
+// @Summary		Get the audit log
+// @Description	Fetches privileged actions, newest first, with pagination
+// @Tags			Auth
+// @Produce		json
+// @Security		BearerAuth
+// @Param			page	query		int					false	"Page number"
+// @Param			limit	query		int					false	"Number of entries per page"
+// @Success		200		{object}	auditLogSerializer	"Successfully fetched audit log"
+// @Failure		403		{string}	string				"Forbidden"
+// @Failure		500		{string}	string				"Internal Server Error"
+// @Router			/auth/audit-log [get]
+func getAuditLog(c *fiber.Ctx) error {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+
+	entries, total, err := audit.List(page, limit)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(http.StatusOK).JSON(auditLogSerializer{Message: "Audit log fetched successfully", Entries: entries, TotalItems: total})
+}
+
+// @Summary		Unlock a login
+// @Description	Clears failed login attempts and any lockout for an email and/or IP address
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Security		BearerAuth
+// @Param			unlockInput	body		unlockInput	true	"Unlock Params"
+// @Success		200			{string}	string		"Login unlocked successfully"
+// @Failure		403			{string}	string		"Forbidden"
+// @Failure		500			{string}	string		"Internal Server Error"
+// @Router			/auth/unlock [post]
+func unlock(c *fiber.Ctx) error {
+	input := new(unlockInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	actorId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	details := map[string]interface{}{}
+
+	if input.Email != "" {
+		if err := guard.store.Reset(accountKey(input.Email)); err != nil {
+			return c.Status(http.StatusInternalServerError).SendString(err.Error())
+		}
+		details["email"] = input.Email
 	}
 
-	c.Cookie(&cookie)
+	if input.IP != "" {
+		if err := guard.store.Reset(ipKey(input.IP)); err != nil {
+			return c.Status(http.StatusInternalServerError).SendString(err.Error())
+		}
+		details["ip"] = input.IP
+	}
+
+	err = audit.Record(audit.Entry{
+		ActorID:    actorId,
+		ActorRole:  middleware.GetRole(c),
+		Action:     "login.unlock",
+		TargetType: "login",
+		Details:    details,
+		IP:         c.IP(),
+	})
+	if err != nil {
+		slog.Error(fmt.Sprintf("could not record unlock: %s", err.Error()))
+	}
+
+	return c.Status(http.StatusOK).SendString("Login unlocked successfully")
+}
+
+type sessionSerializer struct {
+	session.Session
+	Current bool `json:"current"`
+}
+
+type sessionsSerializer struct {
+	Message  string              `json:"message"`
+	Sessions []sessionSerializer `json:"sessions"`
+}
+
+// @Summary		List active sessions
+// @Description	Fetches the devices the authenticated user is logged in on, most recently used first
+// @Tags			Auth
+// @Produce		json
+// @Security		BearerAuth
+// @Success		200	{object}	sessionsSerializer	"Successfully fetched sessions"
+// @Failure		401	{string}	string				"Unauthorized"
+// @Failure		500	{string}	string				"Internal Server Error"
+// @Router			/auth/sessions [get]
+func getSessions(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	sessions, err := session.List(userId)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	currentId := c.Locals("session_id")
+
+	serialized := make([]sessionSerializer, len(sessions))
+	for i, s := range sessions {
+		serialized[i] = sessionSerializer{Session: s, Current: s.ID.Hex() == currentId}
+	}
+
+	return c.Status(http.StatusOK).JSON(sessionsSerializer{Message: "Sessions fetched successfully", Sessions: serialized})
+}
+
+// @Summary		Revoke a session
+// @Description	Logs the authenticated user out of one of their sessions
+// @Tags			Auth
+// @Produce		json
+// @Security		BearerAuth
+// @Param			sessionId	path		string	true	"Session ID"
+// @Success		200			{string}	string	"Session revoked successfully"
+// @Failure		400			{string}	string	"Bad Request"
+// @Failure		404			{string}	string	"Not Found"
+// @Failure		500			{string}	string	"Internal Server Error"
+// @Router			/auth/sessions/{sessionId} [delete]
+func revokeSession(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	sessionId, err := primitive.ObjectIDFromHex(c.Params("sessionId"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).SendString("Invalid Id")
+	}
+
+	revoked, err := session.Revoke(userId, sessionId)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	if !revoked {
+		return c.Status(http.StatusNotFound).SendString("Session not found")
+	}
+
+	if sessionId.Hex() == c.Locals("session_id") {
+		c.ClearCookie("jwt", middleware.CSRFCookie)
+	}
+
+	return c.Status(http.StatusOK).SendString("Session revoked successfully")
+}
+
+// @Summary		Revoke all sessions
+// @Description	Logs the authenticated user out everywhere, including the current session
+// @Tags			Auth
+// @Produce		json
+// @Security		BearerAuth
+// @Success		200	{string}	string	"Sessions revoked successfully"
+// @Failure		500	{string}	string	"Internal Server Error"
+// @Router			/auth/sessions [delete]
+func revokeAllSessions(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	count, err := session.RevokeAll(userId)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	c.ClearCookie("jwt", middleware.CSRFCookie)
+
+	return c.Status(http.StatusOK).SendString(fmt.Sprintf("%d sessions revoked successfully", count))
+}
+
+type accessTokenSerializer struct {
+	Message string             `json:"message"`
+	Token   string             `json:"token,omitempty"`
+	Details *accesstoken.Token `json:"details"`
+}
+
+type accessTokensSerializer struct {
+	Message string              `json:"message"`
+	Tokens  []accesstoken.Token `json:"tokens"`
+}
+
+// @Summary		Create a personal access token
+// @Description	Creates a long-lived token for scripts and integrations. The token is only returned in this response.
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Security		BearerAuth
+// @Param			createAccessTokenInput	body		createAccessTokenInput	true	"Token Params"
+// @Success		201						{object}	accessTokenSerializer	"Token created successfully"
+// @Failure		400						{string}	string					"Bad Request"
+// @Failure		403						{string}	string					"Forbidden"
+// @Failure		500						{string}	string					"Internal Server Error"
+// @Router			/auth/tokens [post]
+func createAccessToken(c *fiber.Ctx) error {
+	input := new(createAccessTokenInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	expiresInDays := input.ExpiresInDays
+	if expiresInDays == 0 {
+		expiresInDays = 90
+	}
+	expiresAt := time.Now().AddDate(0, 0, expiresInDays)
+
+	secret, token, err := accesstoken.Create(userId, input.Name, input.Scopes, expiresAt)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(http.StatusCreated).JSON(accessTokenSerializer{Message: "Token created successfully", Token: secret, Details: token})
+}
+
+// @Summary		List personal access tokens
+// @Description	Fetches the authenticated user's personal access tokens, newest first
+// @Tags			Auth
+// @Produce		json
+// @Security		BearerAuth
+// @Success		200	{object}	accessTokensSerializer	"Successfully fetched tokens"
+// @Failure		403	{string}	string					"Forbidden"
+// @Failure		500	{string}	string					"Internal Server Error"
+// @Router			/auth/tokens [get]
+func getAccessTokens(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	tokens, err := accesstoken.List(userId)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(http.StatusOK).JSON(accessTokensSerializer{Message: "Tokens fetched successfully", Tokens: tokens})
+}
+
+// @Summary		Revoke a personal access token
+// @Tags			Auth
+// @Produce		json
+// @Security		BearerAuth
+// @Param			tokenId	path		string	true	"Token ID"
+// @Success		200		{string}	string	"Token revoked successfully"
+// @Failure		400		{string}	string	"Bad Request"
+// @Failure		404		{string}	string	"Not Found"
+// @Failure		500		{string}	string	"Internal Server Error"
+// @Router			/auth/tokens/{tokenId} [delete]
+func revokeAccessToken(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	tokenId, err := primitive.ObjectIDFromHex(c.Params("tokenId"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).SendString("Invalid Id")
+	}
+
+	revoked, err := accesstoken.Revoke(userId, tokenId)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	if !revoked {
+		return c.Status(http.StatusNotFound).SendString("Token not found")
+	}
+
+	return c.Status(http.StatusOK).SendString("Token revoked successfully")
+}
+
+type accountSerializer struct {
+	Message string `json:"message"`
+	User    *User  `json:"user"`
+}
+
+// @Summary		Change password
+// @Description	Changes the authenticated user's password and logs out their other sessions
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Security		BearerAuth
+// @Param			ChangePasswordInput	body		ChangePasswordInput	true	"Password Params"
+// @Success		200					{string}	string				"Password changed successfully"
+// @Failure		422					{object}	Error				"Validation failed"
+// @Failure		500					{string}	string				"Internal Server Error"
+// @Router			/auth/password [patch]
+func changePassword(c *fiber.Ctx) error {
+	input := new(ChangePasswordInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	sessionId, err := getSessionIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	if err := ChangePassword(userId, sessionId, *input); err != nil {
+		return sendAccountError(c, err)
+	}
+
+	return c.Status(http.StatusOK).SendString("Password changed successfully")
+}
+
+// @Summary		Change email
+// @Description	Sends a confirmation link to the new email address. The email changes once the link is followed.
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Security		BearerAuth
+// @Param			ChangeEmailInput	body		ChangeEmailInput	true	"Email Params"
+// @Success		202					{string}	string				"Confirmation email sent"
+// @Failure		422					{object}	Error				"Validation failed"
+// @Failure		500					{string}	string				"Internal Server Error"
+// @Router			/auth/email [post]
+func changeEmail(c *fiber.Ctx) error {
+	input := new(ChangeEmailInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	if err := RequestEmailChange(userId, *input); err != nil {
+		return sendAccountError(c, err)
+	}
+
+	return c.Status(http.StatusAccepted).SendString("Confirmation email sent")
+}
+
+// @Summary		Confirm email change
+// @Description	Applies a pending email change. This is the link sent to the new address.
+// @Tags			Auth
+// @Produce		json
+// @Param			token	query		string				true	"Confirmation token"
+// @Success		200		{object}	accountSerializer	"Email changed successfully"
+// @Failure		400		{string}	string				"Bad Request"
+// @Failure		500		{string}	string				"Internal Server Error"
+// @Router			/auth/email/confirm [get]
+func confirmEmailChange(c *fiber.Ctx) error {
+	user, err := ConfirmEmailChange(c.Query("token"))
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(accountSerializer{Message: "Email changed successfully", User: user})
+}
+
+// @Summary		Update name
+// @Description	Changes the authenticated user's name, which is also shown as the creator of their posts
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Security		BearerAuth
+// @Param			UpdateNameInput	body		UpdateNameInput		true	"Name Params"
+// @Success		200				{object}	accountSerializer	"Name updated successfully"
+// @Failure		422				{object}	Error				"Validation failed"
+// @Failure		500				{string}	string				"Internal Server Error"
+// @Router			/auth/name [patch]
+func updateName(c *fiber.Ctx) error {
+	input := new(UpdateNameInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	user, err := UpdateName(userId, *input)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(accountSerializer{Message: "Name updated successfully", User: user})
+}
+
+// @Summary		Upload an avatar
+// @Description	Sets the authenticated user's avatar. The image is cropped square and stored 64, 128 and 256 pixels wide.
+// @Tags			Auth
+// @Accept			multipart/form-data
+// @Produce		json
+// @Security		BearerAuth
+// @Param			image	formData	file				true	"Image file"
+// @Success		200		{object}	accountSerializer	"Avatar updated successfully"
+// @Failure		400		{string}	string				"Bad Request"
+// @Failure		422		{object}	Error				"Image upload failed"
+// @Failure		500		{string}	string				"Internal Server Error"
+// @Router			/auth/avatar [put]
+func updateAvatar(c *fiber.Ctx) error {
+	file, err := c.FormFile("image")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	user, err := UpdateAvatar(userId, file)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(accountSerializer{Message: "Avatar updated successfully", User: user})
+}
+
+// @Summary		Remove avatar
+// @Tags			Auth
+// @Produce		json
+// @Security		BearerAuth
+// @Success		200	{object}	accountSerializer	"Avatar removed successfully"
+// @Failure		500	{string}	string				"Internal Server Error"
+// @Router			/auth/avatar [delete]
+func removeAvatar(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	user, err := RemoveAvatar(userId)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(accountSerializer{Message: "Avatar removed successfully", User: user})
+}
+
+// @Summary		Upload a banner
+// @Description	Sets the authenticated user's profile banner. The image is cropped to 3:1 and stored 600 and 1500 pixels wide.
+// @Tags			Auth
+// @Accept			multipart/form-data
+// @Produce		json
+// @Security		BearerAuth
+// @Param			image	formData	file				true	"Image file"
+// @Success		200		{object}	accountSerializer	"Banner updated successfully"
+// @Failure		400		{string}	string				"Bad Request"
+// @Failure		422		{object}	Error				"Image upload failed"
+// @Failure		500		{string}	string				"Internal Server Error"
+// @Router			/auth/banner [put]
+func updateBanner(c *fiber.Ctx) error {
+	file, err := c.FormFile("image")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	user, err := UpdateBanner(userId, file)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(accountSerializer{Message: "Banner updated successfully", User: user})
+}
+
+// @Summary		Remove banner
+// @Tags			Auth
+// @Produce		json
+// @Security		BearerAuth
+// @Success		200	{object}	accountSerializer	"Banner removed successfully"
+// @Failure		500	{string}	string				"Internal Server Error"
+// @Router			/auth/banner [delete]
+func removeBanner(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	user, err := RemoveBanner(userId)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(accountSerializer{Message: "Banner removed successfully", User: user})
+}
+
+type statusSerializer struct {
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+// @Summary		Get status
+// @Description	Returns the authenticated user's status
+// @Tags			Auth
+// @Produce		json
+// @Security		BearerAuth
+// @Success		200	{object}	statusSerializer	"Status fetched successfully"
+// @Failure		401	{string}	string				"Unauthorized"
+// @Failure		404	{string}	string				"Not Found"
+// @Failure		500	{string}	string				"Internal Server Error"
+// @Router			/auth/status [get]
+func getStatus(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	user, err := FindUser(userId)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(statusSerializer{Message: "Status fetched successfully", Status: user.Status})
+}
+
+// @Summary		Update status
+// @Description	Changes the authenticated user's status. An empty status clears it.
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Security		BearerAuth
+// @Param			UpdateStatusInput	body		UpdateStatusInput	true	"Status Params"
+// @Success		200					{object}	statusSerializer	"Status updated successfully"
+// @Failure		422					{object}	Error				"Validation failed"
+// @Failure		500					{string}	string				"Internal Server Error"
+// @Router			/auth/status [patch]
+func updateStatus(c *fiber.Ctx) error {
+	input := new(UpdateStatusInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	user, err := UpdateStatus(userId, *input)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(statusSerializer{Message: "Status updated successfully", Status: user.Status})
+}
+
+type mutedWordsSerializer struct {
+	Message    string      `json:"message"`
+	MutedWords []MutedWord `json:"mutedWords"`
+}
+
+type mutedWordSerializer struct {
+	Message   string     `json:"message"`
+	MutedWord *MutedWord `json:"mutedWord"`
+}
+
+// @Summary		List muted words
+// @Description	Lists the authenticated user's muted words that haven't expired
+// @Tags			Auth
+// @Produce		json
+// @Security		BearerAuth
+// @Success		200	{object}	mutedWordsSerializer	"Muted words fetched successfully"
+// @Failure		401	{string}	string					"Unauthorized"
+// @Failure		500	{string}	string					"Internal Server Error"
+// @Router			/auth/muted-words [get]
+func getMutedWords(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	words, err := ListMutedWords(userId)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(mutedWordsSerializer{Message: "Muted words fetched successfully", MutedWords: words})
+}
+
+// @Summary		Mute a word
+// @Description	Hides posts containing a word, phrase or hashtag, in the timeline, notifications or both.
+// @Description	With the collapse action, matching posts are kept and marked as filtered instead.
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Security		BearerAuth
+// @Param			MutedWordInput	body		MutedWordInput		true	"Muted word Params"
+// @Success		201				{object}	mutedWordSerializer	"Word muted successfully"
+// @Failure		422				{object}	Error				"Validation failed"
+// @Failure		500				{string}	string				"Internal Server Error"
+// @Router			/auth/muted-words [post]
+func addMutedWord(c *fiber.Ctx) error {
+	input := new(MutedWordInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	word, err := AddMutedWord(userId, *input)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+
+	return c.Status(http.StatusCreated).JSON(mutedWordSerializer{Message: "Word muted successfully", MutedWord: word})
+}
+
+// @Summary		Unmute a word
+// @Description	Removes one of the authenticated user's muted words
+// @Tags			Auth
+// @Produce		json
+// @Security		BearerAuth
+// @Param			wordId	path		string	true	"Muted word ID"
+// @Success		200		{string}	string	"Word unmuted successfully"
+// @Failure		400		{string}	string	"Bad Request"
+// @Failure		404		{string}	string	"Not Found"
+// @Failure		500		{string}	string	"Internal Server Error"
+// @Router			/auth/muted-words/{wordId} [delete]
+func removeMutedWord(c *fiber.Ctx) error {
+	wordId, err := primitive.ObjectIDFromHex(c.Params("wordId"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).SendString("Invalid Id")
+	}
+
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	if err := RemoveMutedWord(userId, wordId); err != nil {
+		return sendAccountError(c, err)
+	}
+
+	return c.Status(http.StatusOK).SendString("Word unmuted successfully")
+}
+
+// @Summary		Get a CSRF token
+// @Description	Issues a new CSRF token. Unsafe requests authenticated by the jwt cookie must send it in the X-CSRF-Token header.
+// @Tags			Auth
+// @Produce		json
+// @Security		BearerAuth
+// @Success		200	{object}	csrfSerializer	"CSRF token"
+// @Failure		401	{string}	string			"Unauthorized"
+// @Failure		500	{string}	string			"Internal Server Error"
+// @Router			/auth/csrf [get]
+func csrfToken(c *fiber.Ctx) error {
+	sessionId, err := getSessionIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	s, err := session.Find(sessionId)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	token, err := middleware.IssueCSRFToken(c, s.ExpiresAt)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(http.StatusOK).JSON(csrfSerializer{CSRFToken: token})
+}
+
+// @Summary		Get a websocket ticket
+// @Description	Issues a single-use ticket, valid for 30 seconds, to open the /ws websocket with /ws?ticket=<ticket>. Browsers can't send the Authorization header on websocket upgrades.
+// @Tags			Auth
+// @Produce		json
+// @Security		BearerAuth
+// @Success		200	{object}	wsTicketSerializer	"Websocket ticket"
+// @Failure		401	{string}	string				"Unauthorized"
+// @Failure		500	{string}	string				"Internal Server Error"
+// @Router			/auth/ws-ticket [post]
+func wsTicket(c *fiber.Ctx) error {
+	ticket, expiresAt, err := middleware.IssueWebsocketTicket(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(http.StatusOK).JSON(wsTicketSerializer{Ticket: ticket, ExpiresAt: expiresAt})
+}
+
+type passkeyCeremonySerializer struct {
+	CeremonyID string      `json:"ceremonyId"`
+	Options    interface{} `json:"options"`
+}
+
+type passkeySerializer struct {
+	Message string   `json:"message"`
+	Passkey *Passkey `json:"passkey"`
+}
+
+type passkeysSerializer struct {
+	Message  string    `json:"message"`
+	Passkeys []Passkey `json:"passkeys"`
+}
+
+// @Summary		Start registering a passkey
+// @Description	Returns the options for navigator.credentials.create. Send the resulting credential to /auth/passkeys/register/finish with the ceremony id within 5 minutes.
+// @Tags			Auth
+// @Produce		json
+// @Security		BearerAuth
+// @Success		200	{object}	passkeyCeremonySerializer	"Registration options"
+// @Failure		401	{string}	string						"Unauthorized"
+// @Failure		500	{string}	string						"Internal Server Error"
+// @Router			/auth/passkeys/register/begin [post]
+func beginPasskeyRegistration(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	options, ceremonyId, err := passkeyAuth.beginRegistration(userId)
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(passkeyCeremonySerializer{CeremonyID: ceremonyId, Options: options})
+}
+
+// @Summary		Finish registering a passkey
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Security		BearerAuth
+// @Param			registerPasskeyInput	body		registerPasskeyInput	true	"Passkey Params"
+// @Success		201						{object}	passkeySerializer		"Passkey registered successfully"
+// @Failure		400						{string}	string					"Bad Request"
+// @Failure		422						{object}	Error					"Validation failed"
+// @Failure		500						{string}	string					"Internal Server Error"
+// @Router			/auth/passkeys/register/finish [post]
+func finishPasskeyRegistration(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	input := new(registerPasskeyInput)
+
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	passkey, err := passkeyAuth.finishRegistration(userId, input.CeremonyID, input.Name, bytes.NewReader(input.Credential))
+	if err != nil {
+		return sendAccountError(c, err)
+	}
+
+	return c.Status(http.StatusCreated).JSON(passkeySerializer{Message: "Passkey registered successfully", Passkey: passkey})
+}
+
+// @Summary		List passkeys
+// @Tags			Auth
+// @Produce		json
+// @Security		BearerAuth
+// @Success		200	{object}	passkeysSerializer	"Passkeys fetched successfully"
+// @Failure		401	{string}	string				"Unauthorized"
+// @Failure		500	{string}	string				"Internal Server Error"
+// @Router			/auth/passkeys [get]
+func getPasskeys(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	passkeys, err := ListPasskeys(userId)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(http.StatusOK).JSON(passkeysSerializer{Message: "Passkeys fetched successfully", Passkeys: passkeys})
+}
+
+// @Summary		Delete a passkey
+// @Tags			Auth
+// @Produce		json
+// @Security		BearerAuth
+// @Param			passkeyId	path		string	true	"Passkey ID"
+// @Success		200			{string}	string	"Passkey deleted successfully"
+// @Failure		400			{string}	string	"Bad Request"
+// @Failure		404			{string}	string	"Not Found"
+// @Failure		500			{string}	string	"Internal Server Error"
+// @Router			/auth/passkeys/{passkeyId} [delete]
+func deletePasskey(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	passkeyId, err := primitive.ObjectIDFromHex(c.Params("passkeyId"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).SendString("Invalid Id")
+	}
+
+	if err := DeletePasskey(userId, passkeyId); err != nil {
+		return sendAccountError(c, err)
+	}
+
+	return c.Status(http.StatusOK).SendString("Passkey deleted successfully")
+}
+
+// @Summary		Start logging in with a passkey
+// @Description	Returns the options for navigator.credentials.get. Send the resulting credential to /auth/passkeys/login/finish with the ceremony id within 5 minutes.
+// @Tags			Auth
+// @Produce		json
+// @Success		200	{object}	passkeyCeremonySerializer	"Login options"
+// @Failure		500	{string}	string						"Internal Server Error"
+// @Router			/auth/passkeys/login/begin [post]
+func beginPasskeyLogin(c *fiber.Ctx) error {
+	options, ceremonyId, err := passkeyAuth.beginLogin()
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(http.StatusOK).JSON(passkeyCeremonySerializer{CeremonyID: ceremonyId, Options: options})
+}
+
+// @Summary		Log in with a passkey
+// @Description	Logs in like /auth/login with a credential from navigator.credentials.get
+// @Tags			Auth
+// @Accept			json
+// @Produce		json
+// @Param			passkeyLoginInput	body		passkeyLoginInput	true	"Passkey login Params"
+// @Success		200					{object}	loginSerializer		"Successfully logged in user"
+// @Failure		400					{string}	string				"Bad Request"
+// @Failure		422					{object}	Error				"Validation failed"
+// @Failure		500					{string}	string				"Internal Server Error"
+// @Router			/auth/passkeys/login/finish [post]
+func finishPasskeyLogin(c *fiber.Ctx) error {
+	input := new(passkeyLoginInput)
+
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	user, err := passkeyAuth.finishLogin(input.CeremonyID, bytes.NewReader(input.Credential))
+	if err != nil {
+		return sendAccountError(c, err)
+	}
 
-	return c.Status(http.StatusOK).JSON(loginSerializer{Token: token, UserID: user.ID.Hex()})
+	return completeLogin(c, user)
 }
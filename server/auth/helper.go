@@ -1,14 +1,147 @@
 package auth
 
 import (
-	"golang.org/x/crypto/bcrypt"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Jesuloba-world/social-sum/server/database"
+	"github.com/Jesuloba-world/social-sum/server/imagestore"
+	"github.com/Jesuloba-world/social-sum/server/middleware"
+	"github.com/Jesuloba-world/social-sum/server/passwordhash"
+	"github.com/Jesuloba-world/social-sum/server/session"
+	"github.com/Jesuloba-world/social-sum/server/signing"
 )
 
+// HashPassword hashes a password with the current algorithm and parameters, see passwordhash.
 func HashPassword(password string) (string, error) {
-	// The cost factor  10 is a good balance between security and performance.
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return passwordhash.Hash(password)
+}
+
+// checkPassword reports whether password is the user's password.
+func checkPassword(user *User, password string) (bool, error) {
+	match, _, err := passwordhash.Verify(user.Password, password)
+	return match, err
+}
+
+// rehashPassword stores a fresh hash of the user's password, made with the current parameters.
+func rehashPassword(user *User, password string) error {
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	userCollection := database.Client.Database("Auth").Collection("User")
+
+	// only replace the hash that was verified, in case the password changed meanwhile
+	filter := bson.M{"_id": user.ID, "password": user.Password}
+	_, err = userCollection.UpdateOne(context.TODO(), filter, bson.M{"$set": bson.M{"password": hashedPassword}})
+	return err
+}
+
+func getUserIdFromLocals(c *fiber.Ctx) (primitive.ObjectID, error) {
+	userId, ok := c.Locals("user_id").(string)
+	if !ok {
+		return primitive.ObjectID{}, fmt.Errorf("user not found")
+	}
+	return primitive.ObjectIDFromHex(userId)
+}
+
+// completeLogin starts a session for an authenticated user and responds with its token,
+// which is also set as the jwt cookie.
+func completeLogin(c *fiber.Ctx, user *User) error {
+	expirationTime := time.Now().Add(1 * time.Hour) // 1 hour
+
+	s, err := session.Create(user.ID, c.Get(fiber.HeaderUserAgent), c.IP(), expirationTime)
+	if err != nil {
+		slog.Error(fmt.Sprintf("could not create session: %s", err.Error()))
+		return c.Status(http.StatusInternalServerError).SendString("could not login")
+	}
+
+	// create and sign the claim
+	token, err := signing.Sign(jwt.MapClaims{
+		"user_id": user.ID.Hex(),
+		"email":   user.Email,
+		"role":    user.Role,
+		"sid":     s.ID.Hex(),
+		"iat":     time.Now().Unix(),
+		"exp":     expirationTime.Unix(),
+	})
+
 	if err != nil {
+		slog.Error(fmt.Sprintf("could not login: %s", err.Error()))
+		return c.Status(http.StatusInternalServerError).SendString("could not login")
+	}
+
+	cookie := fiber.Cookie{
+		Name:     "jwt",
+		Value:    token,
+		Expires:  expirationTime,
+		HTTPOnly: true,
+		SameSite: "None",
+		Secure:   true,
+	}
+
+	c.Cookie(&cookie)
+
+	csrfToken, err := middleware.IssueCSRFToken(c, expirationTime)
+	if err != nil {
+		slog.Error(fmt.Sprintf("could not login: %s", err.Error()))
+		return c.Status(http.StatusInternalServerError).SendString("could not login")
+	}
+
+	return c.Status(http.StatusOK).JSON(loginSerializer{Token: token, UserID: user.ID.Hex(), CSRFToken: csrfToken})
+}
+
+// sendAccountError responds to errors returned by the account functions.
+func sendAccountError(c *fiber.Ctx, err error) error {
+	if fields, ok := err.(FieldErrors); ok {
+		return c.Status(http.StatusUnprocessableEntity).JSON(Error{
+			Message: "Validation failed",
+			Error:   fields.Error(),
+			Fields:  fields,
+		})
+	}
+
+	switch err {
+	case ErrUserNotFound, ErrPasskeyNotFound, ErrMutedWordNotFound:
+		return c.Status(http.StatusNotFound).SendString(err.Error())
+	case ErrInvalidEmailChange, ErrInvalidMagicLink, ErrInvalidPasskey, ErrInvalidPasskeyCeremony:
+		return c.Status(http.StatusBadRequest).SendString(err.Error())
+	case ErrMutedWordsFull:
+		return c.Status(http.StatusUnprocessableEntity).SendString(err.Error())
+	case imagestore.ErrUnsupported, imagestore.ErrTooLarge:
+		return c.Status(http.StatusUnprocessableEntity).JSON(Error{
+			Message: "Image upload failed",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.Status(http.StatusInternalServerError).SendString(err.Error())
+}
+
+func getSessionIdFromLocals(c *fiber.Ctx) (primitive.ObjectID, error) {
+	sessionId, ok := c.Locals("session_id").(string)
+	if !ok {
+		return primitive.ObjectID{}, fmt.Errorf("session not found")
+	}
+	return primitive.ObjectIDFromHex(sessionId)
+}
+
+// randomToken returns 256 random bits, encoded for use in URLs and cookies.
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
 		return "", err
 	}
-	return string(hashedPassword), nil
+	return base64.RawURLEncoding.EncodeToString(buf), nil
 }
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"mime/multipart"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Jesuloba-world/social-sum/server/database"
+	"github.com/Jesuloba-world/social-sum/server/imagestore"
+)
+
+var (
+	avatarCrop = imagestore.Crop{AspectWidth: 1, AspectHeight: 1, Widths: []int{64, 128, 256}}
+	bannerCrop = imagestore.Crop{AspectWidth: 3, AspectHeight: 1, Widths: []int{600, 1500}}
+)
+
+// UpdateAvatar crops the image square, stores it in every avatar size and replaces the user's avatar.
+func UpdateAvatar(userId primitive.ObjectID, file *multipart.FileHeader) (*User, error) {
+	return replaceImage(userId, "avatar", file, avatarCrop)
+}
+
+// UpdateBanner crops the image to 3:1, stores it in every banner size and replaces the user's banner.
+func UpdateBanner(userId primitive.ObjectID, file *multipart.FileHeader) (*User, error) {
+	return replaceImage(userId, "banner", file, bannerCrop)
+}
+
+func RemoveAvatar(userId primitive.ObjectID) (*User, error) {
+	return replaceImage(userId, "avatar", nil, avatarCrop)
+}
+
+func RemoveBanner(userId primitive.ObjectID) (*User, error) {
+	return replaceImage(userId, "banner", nil, bannerCrop)
+}
+
+// replaceImage stores the variants of file in the user's field, or clears the field if file is nil,
+// then deletes the files of the image it replaced and notifies OnUserUpdate listeners.
+func replaceImage(userId primitive.ObjectID, field string, file *multipart.FileHeader, crop imagestore.Crop) (*User, error) {
+	var variants imagestore.Variants
+	update := bson.M{
+		"$set":   bson.M{"updatedAt": time.Now()},
+		"$unset": bson.M{field: ""},
+	}
+
+	if file != nil {
+		var err error
+		variants, err = imagestore.SaveCropped(file, crop)
+		if err != nil {
+			return nil, err
+		}
+		update = bson.M{"$set": bson.M{field: variants, "updatedAt": time.Now()}}
+	}
+
+	userCollection := database.Client.Database("Auth").Collection("User")
+
+	// the previous document tells which files to delete
+	user := new(User)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+	err := userCollection.FindOneAndUpdate(context.TODO(), bson.M{"_id": userId}, update, opts).Decode(user)
+	if err != nil {
+		imagestore.Remove(variants)
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	switch field {
+	case "avatar":
+		imagestore.Remove(user.Avatar)
+		user.Avatar = variants
+	case "banner":
+		imagestore.Remove(user.Banner)
+		user.Banner = variants
+	}
+
+	notifyUserUpdate(*user, field)
+
+	return user, nil
+}
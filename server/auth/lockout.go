@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jesuloba-world/social-sum/server/passwordhash"
+)
+
+// lockoutPolicy allows FreeAttempts failures inside Window, then locks the key
+// for BaseDelay, doubling with every further failure up to MaxDelay.
+type lockoutPolicy struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	Window       time.Duration
+}
+
+var (
+	accountLockout = lockoutPolicy{FreeAttempts: 5, BaseDelay: 30 * time.Second, MaxDelay: 15 * time.Minute, Window: time.Hour}
+	ipLockout      = lockoutPolicy{FreeAttempts: 20, BaseDelay: 30 * time.Second, MaxDelay: time.Hour, Window: time.Hour}
+)
+
+func (p lockoutPolicy) delay(failures int) time.Duration {
+	if failures < p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
+
+type loginGuard struct {
+	store AttemptStore
+}
+
+var guard *loginGuard
+
+// newLoginGuard picks the attempt store from LOGIN_ATTEMPT_STORE ("memory" or "mongo").
+// The in-memory store is the default and only protects a single server instance.
+func newLoginGuard() *loginGuard {
+	switch os.Getenv("LOGIN_ATTEMPT_STORE") {
+	case "mongo":
+		store, err := NewMongoAttemptStore()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return &loginGuard{store: store}
+	case "", "memory":
+		return &loginGuard{store: NewMemoryAttemptStore()}
+	default:
+		log.Fatalf("unknown LOGIN_ATTEMPT_STORE: %s", os.Getenv("LOGIN_ATTEMPT_STORE"))
+		return nil
+	}
+}
+
+func accountKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// lockedUntil returns the latest lockout that applies to either the email or the IP.
+func (g *loginGuard) lockedUntil(email, ip string) (time.Time, error) {
+	var until time.Time
+
+	for _, key := range []string{accountKey(email), ipKey(ip)} {
+		record, err := g.store.Get(key)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if record.LockedUntil.After(until) {
+			until = record.LockedUntil
+		}
+	}
+
+	return until, nil
+}
+
+func (g *loginGuard) recordFailure(email, ip string) error {
+	now := time.Now()
+
+	for key, policy := range map[string]lockoutPolicy{accountKey(email): accountLockout, ipKey(ip): ipLockout} {
+		record, err := g.store.Increment(key, now, policy.Window)
+		if err != nil {
+			return err
+		}
+
+		if delay := policy.delay(record.Failures); delay > 0 {
+			if err := g.store.Lock(key, now.Add(delay)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// recordSuccess clears the account's failures. IP failures are kept, so that
+// logging into one account does not reset an attacker's budget for the others.
+func (g *loginGuard) recordSuccess(email string) error {
+	return g.store.Reset(accountKey(email))
+}
+
+// throttle counts a request against the key under the policy. It returns when the key may be
+// used again if it is locked, or the zero time if the request is allowed.
+func (g *loginGuard) throttle(key string, policy lockoutPolicy) (time.Time, error) {
+	now := time.Now()
+
+	record, err := g.store.Get(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if record.LockedUntil.After(now) {
+		return record.LockedUntil, nil
+	}
+
+	record, err = g.store.Increment(key, now, policy.Window)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if delay := policy.delay(record.Failures); delay > 0 {
+		if err := g.store.Lock(key, now.Add(delay)); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	return time.Time{}, nil
+}
+
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+// dummyPasswordHash is compared against when no user matches the email,
+// so a failed login takes the same time whether or not the account exists.
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = passwordhash.Hash("social-sum-dummy-password")
+	})
+	return dummyHash
+}
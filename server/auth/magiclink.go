@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/Jesuloba-world/social-sum/server/database"
+	"github.com/Jesuloba-world/social-sum/server/mailer"
+	"github.com/Jesuloba-world/social-sum/server/signing"
+)
+
+const (
+	magicLinkExpiry = 15 * time.Minute
+	// magicLinkCookie binds a link to the browser that asked for it, so a link
+	// read from someone else's inbox, or sent to a victim, can't log anyone in.
+	magicLinkCookie  = "magic_link_binding"
+	magicLinkPurpose = "magic_link"
+)
+
+var ErrInvalidMagicLink = errors.New("login link is invalid, has expired, or was opened in another browser than the one it was requested from")
+
+// magicLinkLimit allows a few links per email an hour, so the endpoint can't be used to flood an inbox.
+var magicLinkLimit = lockoutPolicy{FreeAttempts: 3, BaseDelay: 15 * time.Minute, MaxDelay: 24 * time.Hour, Window: time.Hour}
+
+func magicLinkKey(email string) string {
+	return "magic-link:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// sendMagicLink emails a login link to the user with the given email, if there is one.
+// Unknown emails are ignored without an error. It runs in the background of the request,
+// so the response doesn't reveal who has an account.
+func sendMagicLink(email, binding string) error {
+	userCollection := database.Client.Database("Auth").Collection("User")
+
+	user := new(User)
+	err := userCollection.FindOne(context.TODO(), bson.M{"email": email}).Decode(user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+
+	now := time.Now()
+	link := MagicLink{
+		UserID:      user.ID,
+		BindingHash: hashToken(binding),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(magicLinkExpiry),
+	}
+
+	magicLinkCollection := database.Client.Database("Auth").Collection("MagicLink")
+
+	// a new link replaces any unused one
+	_, err = magicLinkCollection.DeleteMany(context.TODO(), bson.M{"userId": user.ID})
+	if err != nil {
+		return err
+	}
+
+	result, err := magicLinkCollection.InsertOne(context.TODO(), link)
+	if err != nil {
+		return err
+	}
+	link.ID = result.InsertedID.(primitive.ObjectID)
+
+	token, err := signing.Sign(jwt.MapClaims{
+		"purpose": magicLinkPurpose,
+		"sub":     user.ID.Hex(),
+		"jti":     link.ID.Hex(),
+		"iat":     now.Unix(),
+		"exp":     link.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return mailer.Send(user.Email, "Your Social sum login link", fmt.Sprintf(
+		"Hi %s,\n\nFollow this link within 15 minutes to log in to Social sum. It only works once, and only in the browser you requested it from:\n\n%s\n\nIf you did not ask for this, you can ignore this email.",
+		user.Name, mailer.Link("/auth/magic-link/verify?token="+url.QueryEscape(token)),
+	))
+}
+
+// redeemMagicLink returns the user the link logs in. Links can only be used once,
+// and only with the binding they were requested with.
+func redeemMagicLink(token, binding string) (*User, error) {
+	if binding == "" {
+		return nil, ErrInvalidMagicLink
+	}
+
+	parsed, err := signing.Parse(token)
+	if err != nil || !parsed.Valid {
+		return nil, ErrInvalidMagicLink
+	}
+
+	// login tokens are signed with the same keys, so the purpose tells them apart
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != magicLinkPurpose {
+		return nil, ErrInvalidMagicLink
+	}
+
+	jti, _ := claims["jti"].(string)
+	linkId, err := primitive.ObjectIDFromHex(jti)
+	if err != nil {
+		return nil, ErrInvalidMagicLink
+	}
+
+	magicLinkCollection := database.Client.Database("Auth").Collection("MagicLink")
+
+	link := new(MagicLink)
+	filter := bson.M{
+		"_id":         linkId,
+		"bindingHash": hashToken(binding),
+		"expiresAt":   bson.M{"$gt": time.Now()},
+	}
+	err = magicLinkCollection.FindOneAndDelete(context.TODO(), filter).Decode(link)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInvalidMagicLink
+		}
+		return nil, err
+	}
+
+	if claims["sub"] != link.UserID.Hex() {
+		return nil, ErrInvalidMagicLink
+	}
+
+	return FindUser(link.UserID)
+}
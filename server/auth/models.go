@@ -3,18 +3,31 @@ package auth
 import (
 	"time"
 
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Jesuloba-world/social-sum/server/imagestore"
+	"github.com/Jesuloba-world/social-sum/server/rbac"
 )
 
 type User struct {
-	ID        primitive.ObjectID   `bson:"_id,omitempty" json:"_id"`
-	Email     string               `bson:"email" json:"email"`
-	Password  string               `bson:"password" json:"-"`
-	Name      string               `bson:"name" json:"name"`
-	Status    string               `bson:"status" json:"status"`
-	Posts     []primitive.ObjectID `bson:"posts" json:"posts"`
-	CreatedAt time.Time            `bson:"createdAt" json:"createdAt"`
-	UpdatedAt time.Time            `bson:"updatedAt" json:"updatedAt"`
+	ID             primitive.ObjectID   `bson:"_id,omitempty" json:"_id"`
+	Email          string               `bson:"email" json:"email"`
+	Password       string               `bson:"password" json:"-"`
+	Name           string               `bson:"name" json:"name"`
+	Status         string               `bson:"status" json:"status"`
+	Role           rbac.Role            `bson:"role" json:"role"`
+	Avatar         imagestore.Variants  `bson:"avatar,omitempty" json:"avatar,omitempty"`
+	Banner         imagestore.Variants  `bson:"banner,omitempty" json:"banner,omitempty"`
+	Posts          []primitive.ObjectID `bson:"posts" json:"posts"`
+	FollowerCount  int                  `bson:"followerCount" json:"followerCount"`
+	FollowingCount int                  `bson:"followingCount" json:"followingCount"`
+	Blocked        []primitive.ObjectID `bson:"blocked,omitempty" json:"blocked,omitempty"`
+	Muted          []primitive.ObjectID `bson:"muted,omitempty" json:"muted,omitempty"`
+	MutedWords     []MutedWord          `bson:"mutedWords,omitempty" json:"mutedWords,omitempty"`
+	CreatedAt      time.Time            `bson:"createdAt" json:"createdAt"`
+	UpdatedAt      time.Time            `bson:"updatedAt" json:"updatedAt"`
 }
 
 func (u *User) SetTimestamps() {
@@ -24,3 +37,60 @@ func (u *User) SetTimestamps() {
 	}
 	u.UpdatedAt = now
 }
+
+// MutedWord hides posts whose title or content contain Phrase, in the given contexts,
+// until ExpiresAt. Phrases starting with # match the hashtag only.
+type MutedWord struct {
+	ID        primitive.ObjectID `bson:"_id" json:"_id"`
+	Phrase    string             `bson:"phrase" json:"phrase"`
+	Contexts  []string           `bson:"contexts" json:"contexts"`
+	Action    string             `bson:"action" json:"action"`
+	ExpiresAt *time.Time         `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// EmailChange is a pending email change, waiting for confirmation from the new address.
+type EmailChange struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	NewEmail  string             `bson:"newEmail" json:"newEmail"`
+	TokenHash string             `bson:"tokenHash" json:"-"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	ExpiresAt time.Time          `bson:"expiresAt" json:"expiresAt"`
+}
+
+// MagicLink is a pending passwordless login. The link only works in the browser
+// holding the binding cookie it was requested with.
+type MagicLink struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	UserID      primitive.ObjectID `bson:"userId" json:"userId"`
+	BindingHash string             `bson:"bindingHash" json:"-"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	ExpiresAt   time.Time          `bson:"expiresAt" json:"expiresAt"`
+}
+
+// Passkey is a WebAuthn credential registered by a user.
+type Passkey struct {
+	ID              primitive.ObjectID                `bson:"_id,omitempty" json:"_id"`
+	UserID          primitive.ObjectID                `bson:"userId" json:"userId"`
+	Name            string                            `bson:"name" json:"name"`
+	CredentialID    []byte                            `bson:"credentialId" json:"credentialId"`
+	PublicKey       []byte                            `bson:"publicKey" json:"-"`
+	AttestationType string                            `bson:"attestationType" json:"attestationType"`
+	Transports      []protocol.AuthenticatorTransport `bson:"transports" json:"transports"`
+	AAGUID          []byte                            `bson:"aaguid" json:"aaguid"`
+	SignCount       uint32                            `bson:"signCount" json:"signCount"`
+	BackupEligible  bool                              `bson:"backupEligible" json:"backupEligible"`
+	BackupState     bool                              `bson:"backupState" json:"backupState"`
+	CreatedAt       time.Time                         `bson:"createdAt" json:"createdAt"`
+	LastUsedAt      *time.Time                        `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+}
+
+// PasskeyCeremony holds the challenge of a started WebAuthn registration or login until it is finished.
+type PasskeyCeremony struct {
+	ID        primitive.ObjectID   `bson:"_id,omitempty" json:"_id"`
+	Type      string               `bson:"type" json:"type"`
+	UserID    primitive.ObjectID   `bson:"userId,omitempty" json:"userId,omitempty"`
+	Session   webauthn.SessionData `bson:"session" json:"-"`
+	ExpiresAt time.Time            `bson:"expiresAt" json:"expiresAt"`
+}
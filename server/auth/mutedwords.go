@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Jesuloba-world/social-sum/server/database"
+)
+
+const (
+	// MutedWordContextTimeline covers post listings, the timeline and live post updates.
+	MutedWordContextTimeline = "timeline"
+	// MutedWordContextNotifications covers notifications about posts, such as mentions.
+	MutedWordContextNotifications = "notifications"
+
+	// MutedWordActionHide leaves matching posts out.
+	MutedWordActionHide = "hide"
+	// MutedWordActionCollapse keeps matching posts, marked so clients show a placeholder instead.
+	MutedWordActionCollapse = "collapse"
+
+	maxMutedWords = 200
+)
+
+var (
+	ErrMutedWordNotFound = errors.New("muted word not found")
+	ErrMutedWordsFull    = fmt.Errorf("at most %d words can be muted", maxMutedWords)
+)
+
+// wordBoundary is a character that can't be part of a word. # isn't part of a word, so
+// "go" also matches "#go", while "#go" only matches the hashtag.
+const wordBoundary = `[^\p{L}\p{N}_]`
+
+// Active reports whether the word is muted at the given time.
+func (w MutedWord) Active(now time.Time) bool {
+	return w.ExpiresAt == nil || w.ExpiresAt.After(now)
+}
+
+// ActiveMutedWords returns the user's unexpired muted words for the context and action.
+func (u *User) ActiveMutedWords(context, action string) []MutedWord {
+	now := time.Now()
+
+	var words []MutedWord
+	for _, word := range u.MutedWords {
+		if word.Active(now) && word.Action == action && slices.Contains(word.Contexts, context) {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// phrasePattern matches the phrase as whole words, with any whitespace between them.
+func phrasePattern(phrase string) string {
+	parts := strings.Fields(phrase)
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return strings.Join(parts, `\s+`)
+}
+
+// mutedWordsPattern matches text containing any of the words. The syntax is shared by Go and mongo.
+func mutedWordsPattern(words []MutedWord) string {
+	phrases := make([]string, len(words))
+	for i, word := range words {
+		phrases[i] = phrasePattern(word.Phrase)
+	}
+	return fmt.Sprintf(`(?:^|%s)(?:%s)(?:$|%s)`, wordBoundary, strings.Join(phrases, "|"), wordBoundary)
+}
+
+// MutedWordsRegex returns a case insensitive mongo regex matching text that contains any of the words,
+// or nil if there are none.
+func MutedWordsRegex(words []MutedWord) *primitive.Regex {
+	if len(words) == 0 {
+		return nil
+	}
+	return &primitive.Regex{Pattern: mutedWordsPattern(words), Options: "i"}
+}
+
+// MutedWordMatcher finds muted words in text. The words are compiled once, so a matcher
+// can be kept and reused for as long as none of them expires.
+type MutedWordMatcher struct {
+	words    []MutedWord
+	patterns []*regexp.Regexp
+	// expiresAt is when the first of the words expires, zero if none does
+	expiresAt time.Time
+}
+
+// NewMutedWordMatcher compiles the words.
+func NewMutedWordMatcher(words []MutedWord) *MutedWordMatcher {
+	matcher := &MutedWordMatcher{words: words, patterns: make([]*regexp.Regexp, len(words))}
+	for i, word := range words {
+		matcher.patterns[i] = regexp.MustCompile("(?i)" + mutedWordsPattern(words[i:i+1]))
+		if word.ExpiresAt != nil && (matcher.expiresAt.IsZero() || word.ExpiresAt.Before(matcher.expiresAt)) {
+			matcher.expiresAt = *word.ExpiresAt
+		}
+	}
+	return matcher
+}
+
+// Match returns the first of the words contained in any of texts, or nil.
+func (m *MutedWordMatcher) Match(texts ...string) *MutedWord {
+	for i, pattern := range m.patterns {
+		for _, text := range texts {
+			if pattern.MatchString(text) {
+				return &m.words[i]
+			}
+		}
+	}
+	return nil
+}
+
+// Expired reports whether one of the words has expired since the matcher was made.
+func (m *MutedWordMatcher) Expired(now time.Time) bool {
+	return !m.expiresAt.IsZero() && !now.Before(m.expiresAt)
+}
+
+// ListMutedWords returns the user's muted words that haven't expired.
+func ListMutedWords(userId primitive.ObjectID) ([]MutedWord, error) {
+	user, err := FindUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	words := []MutedWord{}
+	for _, word := range user.MutedWords {
+		if word.Active(now) {
+			words = append(words, word)
+		}
+	}
+	return words, nil
+}
+
+// AddMutedWord mutes a word for the user. Expired words are removed at the same time.
+func AddMutedWord(userId primitive.ObjectID, input MutedWordInput) (*MutedWord, error) {
+	input.Phrase = strings.TrimSpace(input.Phrase)
+
+	if err := Validator.Struct(input); err != nil {
+		return nil, toFieldErrors(err)
+	}
+
+	now := time.Now()
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(now) {
+		return nil, FieldErrors{"expiresAt": "must be in the future"}
+	}
+
+	word := MutedWord{
+		ID:        primitive.NewObjectID(),
+		Phrase:    input.Phrase,
+		Contexts:  input.Contexts,
+		Action:    input.Action,
+		ExpiresAt: input.ExpiresAt,
+		CreatedAt: now,
+	}
+	if len(word.Contexts) == 0 {
+		word.Contexts = []string{MutedWordContextTimeline, MutedWordContextNotifications}
+	}
+	if word.Action == "" {
+		word.Action = MutedWordActionHide
+	}
+
+	userCollection := database.Client.Database("Auth").Collection("User")
+
+	// a $pull and a $push can't change the same array in one update, so expired words are removed first
+	_, err := userCollection.UpdateByID(context.TODO(), userId, bson.M{"$pull": bson.M{"mutedWords": bson.M{"expiresAt": bson.M{"$lte": now}}}})
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"_id": userId, fmt.Sprintf("mutedWords.%d", maxMutedWords-1): bson.M{"$exists": false}}
+	update := bson.M{
+		"$push": bson.M{"mutedWords": word},
+		"$set":  bson.M{"updatedAt": now},
+	}
+
+	user := new(User)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = userCollection.FindOneAndUpdate(context.TODO(), filter, update, opts).Decode(user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrMutedWordsFull
+		}
+		return nil, err
+	}
+
+	notifyUserUpdate(*user, "mutedWords")
+
+	return &word, nil
+}
+
+// RemoveMutedWord unmutes one of the user's words.
+func RemoveMutedWord(userId, wordId primitive.ObjectID) error {
+	userCollection := database.Client.Database("Auth").Collection("User")
+
+	filter := bson.M{"_id": userId, "mutedWords._id": wordId}
+	update := bson.M{
+		"$pull": bson.M{"mutedWords": bson.M{"_id": wordId}},
+		"$set":  bson.M{"updatedAt": time.Now()},
+	}
+
+	user := new(User)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := userCollection.FindOneAndUpdate(context.TODO(), filter, update, opts).Decode(user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrMutedWordNotFound
+		}
+		return err
+	}
+
+	notifyUserUpdate(*user, "mutedWords")
+
+	return nil
+}
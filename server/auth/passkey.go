@@ -0,0 +1,437 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Jesuloba-world/social-sum/server/database"
+)
+
+const (
+	passkeyCeremonyExpiry = 5 * time.Minute
+
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+)
+
+var (
+	ErrPasskeyNotFound        = errors.New("passkey not found")
+	ErrInvalidPasskey         = errors.New("passkey could not be verified")
+	ErrInvalidPasskeyCeremony = errors.New("passkey request is invalid or has expired, start again")
+)
+
+// passkeyAuth runs the passkey ceremonies. Router sets it up.
+var passkeyAuth *passkeyService
+
+// passkeyStore keeps passkeys, the users they belong to and the ceremonies in progress.
+type passkeyStore interface {
+	FindUser(userId primitive.ObjectID) (*User, error)
+	ListPasskeys(userId primitive.ObjectID) ([]Passkey, error)
+	// InsertPasskey sets the id of the new passkey. It returns ErrInvalidPasskey if the credential is already registered.
+	InsertPasskey(passkey *Passkey) error
+	// UpdatePasskeyUse records a login with the credential.
+	UpdatePasskeyUse(userId primitive.ObjectID, credential *webauthn.Credential, usedAt time.Time) error
+	SaveCeremony(ceremony *PasskeyCeremony) (string, error)
+	// TakeCeremony returns the ceremony if it hasn't expired and deletes it, so every challenge can only be
+	// answered once. A zero userId matches ceremonies of any user. It returns ErrInvalidPasskeyCeremony if there is none.
+	TakeCeremony(ceremonyType string, userId primitive.ObjectID, ceremonyId string, now time.Time) (*PasskeyCeremony, error)
+}
+
+// passkeyService registers passkeys and logs users in with them.
+type passkeyService struct {
+	rp    *webauthn.WebAuthn
+	store passkeyStore
+}
+
+func newPasskeyService(rp *webauthn.WebAuthn, store passkeyStore) *passkeyService {
+	return &passkeyService{rp: rp, store: store}
+}
+
+// newRelyingParty configures WebAuthn from WEBAUTHN_RP_ID, the domain passkeys are bound to,
+// WEBAUTHN_RP_ORIGINS, the comma separated origins of the pages that use them, and WEBAUTHN_RP_NAME.
+func newRelyingParty() *webauthn.WebAuthn {
+	rp, err := webauthn.New(&webauthn.Config{
+		RPID:          envString("WEBAUTHN_RP_ID", "localhost"),
+		RPDisplayName: envString("WEBAUTHN_RP_NAME", "Social sum"),
+		RPOrigins:     strings.Split(envString("WEBAUTHN_RP_ORIGINS", "http://localhost:5173"), ","),
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: passkeyCeremonyExpiry, TimeoutUVD: passkeyCeremonyExpiry},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: passkeyCeremonyExpiry, TimeoutUVD: passkeyCeremonyExpiry},
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return rp
+}
+
+func envString(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func passkeyCollection() *mongo.Collection {
+	return database.Client.Database("Auth").Collection("Passkey")
+}
+
+func passkeyCeremonyCollection() *mongo.Collection {
+	return database.Client.Database("Auth").Collection("PasskeyCeremony")
+}
+
+// EnsureIndexes makes credential ids unique, lets mongo remove unfinished passkey ceremonies,
+// and indexes block lists.
+func EnsureIndexes() error {
+	_, err := passkeyCollection().Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.M{"credentialId": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"userId": 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = passkeyCeremonyCollection().Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys: bson.M{"expiresAt": 1}, Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Client.Database("Auth").Collection("User").Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		// BlockedBy looks users up by the ids in their block list
+		{Keys: bson.M{"blocked": 1}},
+		// FindUsersByName needs the same collation as its queries to use the index
+		{Keys: bson.M{"name": 1}, Options: options.Index().SetCollation(nameCollation)},
+	})
+	return err
+}
+
+// webauthnUser adapts a user and their passkeys to webauthn.User.
+type webauthnUser struct {
+	user     *User
+	passkeys []Passkey
+}
+
+// WebAuthnID is the user handle. The user id is used, since it is already public and opaque.
+func (u *webauthnUser) WebAuthnID() []byte {
+	return u.user.ID[:]
+}
+
+func (u *webauthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webauthnUser) WebAuthnDisplayName() string {
+	return u.user.Name
+}
+
+func (u *webauthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.passkeys))
+	for i, passkey := range u.passkeys {
+		credentials[i] = passkey.credential()
+	}
+	return credentials
+}
+
+func (p Passkey) credential() webauthn.Credential {
+	return webauthn.Credential{
+		ID:              p.CredentialID,
+		PublicKey:       p.PublicKey,
+		AttestationType: p.AttestationType,
+		Transport:       p.Transports,
+		Flags: webauthn.CredentialFlags{
+			BackupEligible: p.BackupEligible,
+			BackupState:    p.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    p.AAGUID,
+			SignCount: p.SignCount,
+		},
+	}
+}
+
+func (s *passkeyService) loadUser(userId primitive.ObjectID) (*webauthnUser, error) {
+	user, err := s.store.FindUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys, err := s.store.ListPasskeys(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webauthnUser{user: user, passkeys: passkeys}, nil
+}
+
+func (s *passkeyService) saveCeremony(ceremonyType string, userId primitive.ObjectID, session *webauthn.SessionData) (string, error) {
+	return s.store.SaveCeremony(&PasskeyCeremony{
+		Type:      ceremonyType,
+		UserID:    userId,
+		Session:   *session,
+		ExpiresAt: time.Now().Add(passkeyCeremonyExpiry),
+	})
+}
+
+// beginRegistration starts registering a new passkey for the user. The returned options
+// are passed to navigator.credentials.create, and the ceremony id to finishRegistration.
+func (s *passkeyService) beginRegistration(userId primitive.ObjectID) (*protocol.CredentialCreation, string, error) {
+	user, err := s.loadUser(userId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, len(user.passkeys))
+	for i, passkey := range user.passkeys {
+		exclusions[i] = passkey.credential().Descriptor()
+	}
+
+	// passkeys have to be discoverable, since login doesn't ask for an email first
+	creation, session, err := s.rp.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ceremonyId, err := s.saveCeremony(ceremonyRegistration, userId, session)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return creation, ceremonyId, nil
+}
+
+// finishRegistration verifies the authenticator's response, in the JSON format of a
+// PublicKeyCredential, and stores the new passkey under the given name.
+func (s *passkeyService) finishRegistration(userId primitive.ObjectID, ceremonyId, name string, response io.Reader) (*Passkey, error) {
+	ceremony, err := s.store.TakeCeremony(ceremonyRegistration, userId, ceremonyId, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.loadUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(response)
+	if err != nil {
+		return nil, ErrInvalidPasskey
+	}
+
+	credential, err := s.rp.CreateCredential(user, ceremony.Session, parsed)
+	if err != nil {
+		return nil, ErrInvalidPasskey
+	}
+
+	if name == "" {
+		name = "Passkey"
+	}
+
+	passkey := &Passkey{
+		UserID:          userId,
+		Name:            name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      credential.Transport,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		CreatedAt:       time.Now(),
+	}
+
+	if err := s.store.InsertPasskey(passkey); err != nil {
+		return nil, err
+	}
+
+	return passkey, nil
+}
+
+// beginLogin starts a login with any discoverable passkey. The returned options
+// are passed to navigator.credentials.get, and the ceremony id to finishLogin.
+func (s *passkeyService) beginLogin() (*protocol.CredentialAssertion, string, error) {
+	assertion, session, err := s.rp.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ceremonyId, err := s.saveCeremony(ceremonyLogin, primitive.NilObjectID, session)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return assertion, ceremonyId, nil
+}
+
+// finishLogin verifies the authenticator's assertion, in the JSON format of a
+// PublicKeyCredential, and returns the user it belongs to.
+func (s *passkeyService) finishLogin(ceremonyId string, response io.Reader) (*User, error) {
+	ceremony, err := s.store.TakeCeremony(ceremonyLogin, primitive.NilObjectID, ceremonyId, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(response)
+	if err != nil {
+		return nil, ErrInvalidPasskey
+	}
+
+	var user *webauthnUser
+	findUser := func(rawID, userHandle []byte) (webauthn.User, error) {
+		if len(userHandle) != len(primitive.ObjectID{}) {
+			return nil, ErrInvalidPasskey
+		}
+
+		var userId primitive.ObjectID
+		copy(userId[:], userHandle)
+
+		user, err = s.loadUser(userId)
+		if err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	credential, err := s.rp.ValidateDiscoverableLogin(findUser, ceremony.Session, parsed)
+	if err != nil {
+		return nil, ErrInvalidPasskey
+	}
+
+	// a counter that didn't go up means the private key may have been copied
+	if credential.Authenticator.CloneWarning {
+		return nil, ErrInvalidPasskey
+	}
+
+	if err := s.store.UpdatePasskeyUse(user.user.ID, credential, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return user.user, nil
+}
+
+// mongoPasskeyStore keeps passkeys and ceremonies in the Auth database.
+type mongoPasskeyStore struct{}
+
+func (mongoPasskeyStore) FindUser(userId primitive.ObjectID) (*User, error) {
+	return FindUser(userId)
+}
+
+func (mongoPasskeyStore) ListPasskeys(userId primitive.ObjectID) ([]Passkey, error) {
+	return ListPasskeys(userId)
+}
+
+func (mongoPasskeyStore) InsertPasskey(passkey *Passkey) error {
+	result, err := passkeyCollection().InsertOne(context.TODO(), passkey)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrInvalidPasskey
+		}
+		return err
+	}
+
+	passkey.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (mongoPasskeyStore) UpdatePasskeyUse(userId primitive.ObjectID, credential *webauthn.Credential, usedAt time.Time) error {
+	update := bson.M{
+		"$set": bson.M{
+			"signCount":   credential.Authenticator.SignCount,
+			"backupState": credential.Flags.BackupState,
+			"lastUsedAt":  usedAt,
+		},
+	}
+
+	_, err := passkeyCollection().UpdateOne(context.TODO(), bson.M{"credentialId": credential.ID, "userId": userId}, update)
+	return err
+}
+
+func (mongoPasskeyStore) SaveCeremony(ceremony *PasskeyCeremony) (string, error) {
+	result, err := passkeyCeremonyCollection().InsertOne(context.TODO(), ceremony)
+	if err != nil {
+		return "", err
+	}
+
+	return result.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+func (mongoPasskeyStore) TakeCeremony(ceremonyType string, userId primitive.ObjectID, ceremonyId string, now time.Time) (*PasskeyCeremony, error) {
+	id, err := primitive.ObjectIDFromHex(ceremonyId)
+	if err != nil {
+		return nil, ErrInvalidPasskeyCeremony
+	}
+
+	filter := bson.M{
+		"_id":       id,
+		"type":      ceremonyType,
+		"expiresAt": bson.M{"$gt": now},
+	}
+	if !userId.IsZero() {
+		filter["userId"] = userId
+	}
+
+	ceremony := new(PasskeyCeremony)
+	err = passkeyCeremonyCollection().FindOneAndDelete(context.TODO(), filter).Decode(ceremony)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInvalidPasskeyCeremony
+		}
+		return nil, err
+	}
+
+	return ceremony, nil
+}
+
+// ListPasskeys returns the user's passkeys, oldest first.
+func ListPasskeys(userId primitive.ObjectID) ([]Passkey, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+
+	cursor, err := passkeyCollection().Find(context.TODO(), bson.M{"userId": userId}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	passkeys := []Passkey{}
+	if err := cursor.All(context.TODO(), &passkeys); err != nil {
+		return nil, err
+	}
+
+	return passkeys, nil
+}
+
+// DeletePasskey removes one of the user's passkeys, or returns ErrPasskeyNotFound.
+func DeletePasskey(userId, passkeyId primitive.ObjectID) error {
+	result, err := passkeyCollection().DeleteOne(context.TODO(), bson.M{"_id": passkeyId, "userId": userId})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrPasskeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,436 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:5173"
+)
+
+// memoryPasskeyStore is a passkeyStore for tests.
+type memoryPasskeyStore struct {
+	mu         sync.Mutex
+	users      map[primitive.ObjectID]*User
+	passkeys   []Passkey
+	ceremonies map[string]PasskeyCeremony
+}
+
+func newMemoryPasskeyStore(users ...*User) *memoryPasskeyStore {
+	store := &memoryPasskeyStore{users: map[primitive.ObjectID]*User{}, ceremonies: map[string]PasskeyCeremony{}}
+	for _, user := range users {
+		store.users[user.ID] = user
+	}
+	return store
+}
+
+func (s *memoryPasskeyStore) FindUser(userId primitive.ObjectID) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return nil, errors.New("user not found")
+	}
+	return user, nil
+}
+
+func (s *memoryPasskeyStore) ListPasskeys(userId primitive.ObjectID) ([]Passkey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	passkeys := []Passkey{}
+	for _, passkey := range s.passkeys {
+		if passkey.UserID == userId {
+			passkeys = append(passkeys, passkey)
+		}
+	}
+	return passkeys, nil
+}
+
+func (s *memoryPasskeyStore) InsertPasskey(passkey *Passkey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.passkeys {
+		if bytes.Equal(existing.CredentialID, passkey.CredentialID) {
+			return ErrInvalidPasskey
+		}
+	}
+
+	passkey.ID = primitive.NewObjectID()
+	s.passkeys = append(s.passkeys, *passkey)
+	return nil
+}
+
+func (s *memoryPasskeyStore) UpdatePasskeyUse(userId primitive.ObjectID, credential *webauthn.Credential, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.passkeys {
+		if s.passkeys[i].UserID == userId && bytes.Equal(s.passkeys[i].CredentialID, credential.ID) {
+			s.passkeys[i].SignCount = credential.Authenticator.SignCount
+			s.passkeys[i].BackupState = credential.Flags.BackupState
+			s.passkeys[i].LastUsedAt = &usedAt
+		}
+	}
+	return nil
+}
+
+func (s *memoryPasskeyStore) SaveCeremony(ceremony *PasskeyCeremony) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ceremony.ID = primitive.NewObjectID()
+	s.ceremonies[ceremony.ID.Hex()] = *ceremony
+	return ceremony.ID.Hex(), nil
+}
+
+func (s *memoryPasskeyStore) TakeCeremony(ceremonyType string, userId primitive.ObjectID, ceremonyId string, now time.Time) (*PasskeyCeremony, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ceremony, ok := s.ceremonies[ceremonyId]
+	if !ok || ceremony.Type != ceremonyType || !now.Before(ceremony.ExpiresAt) || (!userId.IsZero() && ceremony.UserID != userId) {
+		return nil, ErrInvalidPasskeyCeremony
+	}
+
+	delete(s.ceremonies, ceremonyId)
+	return &ceremony, nil
+}
+
+// softAuthenticator is an ES256 authenticator holding a single discoverable credential.
+type softAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	counter      uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatal(err)
+	}
+
+	return &softAuthenticator{t: t, key: key, credentialID: credentialID}
+}
+
+func (a *softAuthenticator) clientData(ceremonyType protocol.CeremonyType, challenge, origin string) []byte {
+	data, err := json.Marshal(protocol.CollectedClientData{Type: ceremonyType, Challenge: challenge, Origin: origin})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return data
+}
+
+// authData builds authenticator data, with the credential's public key when attested is set.
+func (a *softAuthenticator) authData(attested bool) []byte {
+	rpIdHash := sha256.Sum256([]byte(testRPID))
+
+	flags := protocol.FlagUserPresent | protocol.FlagUserVerified
+	if attested {
+		flags |= protocol.FlagAttestedCredentialData
+	}
+
+	data := append([]byte{}, rpIdHash[:]...)
+	data = append(data, byte(flags))
+	data = binary.BigEndian.AppendUint32(data, a.counter)
+	if !attested {
+		return data
+	}
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	data = append(data, make([]byte, 16)...)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+	data = append(data, a.credentialID...)
+	return append(data, publicKey...)
+}
+
+// create answers navigator.credentials.create with a "none" attestation.
+func (a *softAuthenticator) create(creation *protocol.CredentialCreation, origin string) []byte {
+	a.userHandle = creation.Response.User.ID.(protocol.URLEncodedBase64)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authData(true),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return a.credential(map[string]any{
+		"clientDataJSON":    encode(a.clientData(protocol.CreateCeremony, creation.Response.Challenge.String(), origin)),
+		"attestationObject": encode(attestationObject),
+	})
+}
+
+// get answers navigator.credentials.get, signing with the given counter.
+func (a *softAuthenticator) get(assertion *protocol.CredentialAssertion, origin string, counter uint32) []byte {
+	a.counter = counter
+
+	authData := a.authData(false)
+	clientData := a.clientData(protocol.AssertCeremony, assertion.Response.Challenge.String(), origin)
+	clientDataHash := sha256.Sum256(clientData)
+
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	return a.credential(map[string]any{
+		"clientDataJSON":    encode(clientData),
+		"authenticatorData": encode(authData),
+		"signature":         encode(signature),
+		"userHandle":        encode(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) credential(response map[string]any) []byte {
+	body, err := json.Marshal(map[string]any{
+		"id":       encode(a.credentialID),
+		"rawId":    encode(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return body
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func newTestPasskeyService(t *testing.T) (*passkeyService, *memoryPasskeyStore, *User) {
+	rp, err := webauthn.New(&webauthn.Config{
+		RPID:          testRPID,
+		RPDisplayName: "Social sum",
+		RPOrigins:     []string{testOrigin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &User{ID: primitive.NewObjectID(), Email: "jane@example.com", Name: "jane"}
+	store := newMemoryPasskeyStore(user)
+	return newPasskeyService(rp, store), store, user
+}
+
+// registerPasskey runs a whole registration ceremony for the user.
+func registerPasskey(t *testing.T, service *passkeyService, user *User, authenticator *softAuthenticator) *Passkey {
+	creation, ceremonyId, err := service.beginRegistration(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passkey, err := service.finishRegistration(user.ID, ceremonyId, "Laptop", bytes.NewReader(authenticator.create(creation, testOrigin)))
+	if err != nil {
+		t.Fatalf("registration failed: %v", err)
+	}
+	return passkey
+}
+
+// loginWithPasskey runs a whole login ceremony with the given counter.
+func loginWithPasskey(t *testing.T, service *passkeyService, authenticator *softAuthenticator, counter uint32) (*User, error) {
+	assertion, ceremonyId, err := service.beginLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return service.finishLogin(ceremonyId, bytes.NewReader(authenticator.get(assertion, testOrigin, counter)))
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	service, store, user := newTestPasskeyService(t)
+	authenticator := newSoftAuthenticator(t)
+
+	passkey := registerPasskey(t, service, user, authenticator)
+	if passkey.Name != "Laptop" || !bytes.Equal(passkey.CredentialID, authenticator.credentialID) {
+		t.Fatalf("unexpected passkey %+v", passkey)
+	}
+
+	loggedIn, err := loginWithPasskey(t, service, authenticator, 1)
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if loggedIn.ID != user.ID {
+		t.Fatalf("logged in as %s, want %s", loggedIn.ID.Hex(), user.ID.Hex())
+	}
+
+	passkeys, _ := store.ListPasskeys(user.ID)
+	if passkeys[0].SignCount != 1 || passkeys[0].LastUsedAt == nil {
+		t.Fatalf("login wasn't recorded: %+v", passkeys[0])
+	}
+}
+
+func TestPasskeyRegistrationRejectsBadChallenge(t *testing.T) {
+	service, store, user := newTestPasskeyService(t)
+	authenticator := newSoftAuthenticator(t)
+
+	creation, _, err := service.beginRegistration(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ceremonyId, err := service.beginRegistration(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the response answers the first ceremony's challenge
+	_, err = service.finishRegistration(user.ID, ceremonyId, "", bytes.NewReader(authenticator.create(creation, testOrigin)))
+	if !errors.Is(err, ErrInvalidPasskey) {
+		t.Fatalf("got %v, want ErrInvalidPasskey", err)
+	}
+
+	if passkeys, _ := store.ListPasskeys(user.ID); len(passkeys) != 0 {
+		t.Fatalf("stored %d passkeys, want none", len(passkeys))
+	}
+}
+
+func TestPasskeyRegistrationRejectsWrongOrigin(t *testing.T) {
+	service, _, user := newTestPasskeyService(t)
+	authenticator := newSoftAuthenticator(t)
+
+	creation, ceremonyId, err := service.beginRegistration(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = service.finishRegistration(user.ID, ceremonyId, "", bytes.NewReader(authenticator.create(creation, "https://evil.example")))
+	if !errors.Is(err, ErrInvalidPasskey) {
+		t.Fatalf("got %v, want ErrInvalidPasskey", err)
+	}
+}
+
+func TestPasskeyLoginRejectsBadChallenge(t *testing.T) {
+	service, _, user := newTestPasskeyService(t)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, service, user, authenticator)
+
+	assertion, _, err := service.beginLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ceremonyId, err := service.beginLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = service.finishLogin(ceremonyId, bytes.NewReader(authenticator.get(assertion, testOrigin, 1)))
+	if !errors.Is(err, ErrInvalidPasskey) {
+		t.Fatalf("got %v, want ErrInvalidPasskey", err)
+	}
+}
+
+func TestPasskeyLoginRejectsWrongOrigin(t *testing.T) {
+	service, _, user := newTestPasskeyService(t)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, service, user, authenticator)
+
+	assertion, ceremonyId, err := service.beginLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = service.finishLogin(ceremonyId, bytes.NewReader(authenticator.get(assertion, "https://evil.example", 1)))
+	if !errors.Is(err, ErrInvalidPasskey) {
+		t.Fatalf("got %v, want ErrInvalidPasskey", err)
+	}
+}
+
+func TestPasskeyLoginRejectsSignCountRegression(t *testing.T) {
+	service, store, user := newTestPasskeyService(t)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, service, user, authenticator)
+
+	if _, err := loginWithPasskey(t, service, authenticator, 5); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+
+	// a copy of the key that signed fewer times
+	if _, err := loginWithPasskey(t, service, authenticator, 3); !errors.Is(err, ErrInvalidPasskey) {
+		t.Fatalf("got %v, want ErrInvalidPasskey", err)
+	}
+
+	if passkeys, _ := store.ListPasskeys(user.ID); passkeys[0].SignCount != 5 {
+		t.Fatalf("sign count is %d, want 5", passkeys[0].SignCount)
+	}
+}
+
+func TestPasskeyCeremonyCannotBeReplayed(t *testing.T) {
+	service, _, user := newTestPasskeyService(t)
+	authenticator := newSoftAuthenticator(t)
+
+	creation, ceremonyId, err := service.beginRegistration(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := authenticator.create(creation, testOrigin)
+	if _, err := service.finishRegistration(user.ID, ceremonyId, "", bytes.NewReader(response)); err != nil {
+		t.Fatalf("registration failed: %v", err)
+	}
+	if _, err := service.finishRegistration(user.ID, ceremonyId, "", bytes.NewReader(response)); !errors.Is(err, ErrInvalidPasskeyCeremony) {
+		t.Fatalf("replayed registration: got %v, want ErrInvalidPasskeyCeremony", err)
+	}
+
+	assertion, ceremonyId, err := service.beginLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	response = authenticator.get(assertion, testOrigin, 1)
+	if _, err := service.finishLogin(ceremonyId, bytes.NewReader(response)); err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if _, err := service.finishLogin(ceremonyId, bytes.NewReader(response)); !errors.Is(err, ErrInvalidPasskeyCeremony) {
+		t.Fatalf("replayed login: got %v, want ErrInvalidPasskeyCeremony", err)
+	}
+
+	// nor can the assertion answer a new ceremony
+	_, ceremonyId, err = service.beginLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.finishLogin(ceremonyId, bytes.NewReader(response)); !errors.Is(err, ErrInvalidPasskey) {
+		t.Fatalf("replayed assertion: got %v, want ErrInvalidPasskey", err)
+	}
+}
@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+//go:embed data/common_passwords.txt
+var commonPasswordList string
+
+// PasswordPolicy is the set of rules every new password has to pass.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// RejectCommon rejects passwords from the embedded list of common passwords.
+	RejectCommon bool
+	// BreachedDir is an offline copy of a k-anonymity breach corpus, in the format of the
+	// Have I Been Pwned range API: one file per SHA-1 prefix, e.g. "21BD1.txt", holding
+	// "SUFFIX:COUNT" lines for the remaining 35 hex characters. Empty disables the check.
+	BreachedDir string
+	// RejectSimilar rejects passwords that contain, or are close to, the user's email or name.
+	RejectSimilar bool
+}
+
+var (
+	passwordPolicy     PasswordPolicy
+	passwordPolicyOnce sync.Once
+	commonPasswords    map[string]bool
+)
+
+// currentPasswordPolicy reads the policy from the environment on first use:
+// PASSWORD_MIN_LENGTH, PASSWORD_MAX_LENGTH, PASSWORD_REJECT_COMMON,
+// PASSWORD_BREACHED_DIR and PASSWORD_REJECT_SIMILAR.
+func currentPasswordPolicy() PasswordPolicy {
+	passwordPolicyOnce.Do(func() {
+		passwordPolicy = PasswordPolicy{
+			MinLength:     envInt("PASSWORD_MIN_LENGTH", 8),
+			MaxLength:     envInt("PASSWORD_MAX_LENGTH", 128),
+			RejectCommon:  envBool("PASSWORD_REJECT_COMMON", true),
+			BreachedDir:   os.Getenv("PASSWORD_BREACHED_DIR"),
+			RejectSimilar: envBool("PASSWORD_REJECT_SIMILAR", true),
+		}
+
+		commonPasswords = make(map[string]bool)
+		for _, line := range strings.Split(commonPasswordList, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				commonPasswords[strings.ToLower(line)] = true
+			}
+		}
+	})
+	return passwordPolicy
+}
+
+func envInt(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func envBool(name string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(name))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// FieldErrors maps an input field to the reason it was rejected.
+type FieldErrors map[string]string
+
+func (f FieldErrors) Error() string {
+	fields := make([]string, 0, len(f))
+	for field := range f {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	messages := make([]string, len(fields))
+	for i, field := range fields {
+		messages[i] = fmt.Sprintf("%s %s", field, f[field])
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+// ValidatePassword checks a new password against the password policy.
+// Errors are reported under field, so password change forms can name their own input.
+func ValidatePassword(field, password, email, name string) error {
+	policy := currentPasswordPolicy()
+
+	length := utf8.RuneCountInString(password)
+	if length < policy.MinLength {
+		return FieldErrors{field: fmt.Sprintf("must be at least %d characters long", policy.MinLength)}
+	}
+	if length > policy.MaxLength {
+		return FieldErrors{field: fmt.Sprintf("must be at most %d characters long", policy.MaxLength)}
+	}
+
+	if policy.RejectCommon && commonPasswords[strings.ToLower(password)] {
+		return FieldErrors{field: "is too common, choose a less predictable password"}
+	}
+
+	if policy.RejectSimilar && isSimilarToIdentity(password, email, name) {
+		return FieldErrors{field: "is too similar to your email or name"}
+	}
+
+	if policy.BreachedDir != "" {
+		breached, err := isBreached(policy.BreachedDir, password)
+		if err != nil {
+			return fmt.Errorf("could not check password against breach data: %w", err)
+		}
+		if breached {
+			return FieldErrors{field: "has appeared in a data breach, choose a different password"}
+		}
+	}
+
+	return nil
+}
+
+// isBreached looks the password up by the first five hex characters of its SHA-1 hash,
+// the same way the range API does, so the full hash is never matched against an index.
+func isBreached(dir, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := digest[:5], digest[5:]
+
+	file, err := os.Open(filepath.Join(dir, prefix+".txt"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.EqualFold(strings.TrimSpace(line), suffix) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
+
+// isSimilarToIdentity reports whether the password contains, is contained in,
+// or is a few edits away from the email's local part or any part of the name.
+func isSimilarToIdentity(password, email, name string) bool {
+	password = strings.ToLower(password)
+
+	candidates := strings.Fields(strings.ToLower(name))
+	candidates = append(candidates, strings.ToLower(strings.Join(strings.Fields(name), "")))
+	if local, _, found := strings.Cut(strings.ToLower(email), "@"); found {
+		candidates = append(candidates, local)
+	}
+
+	for _, candidate := range candidates {
+		if utf8.RuneCountInString(candidate) < 3 {
+			continue
+		}
+		if strings.Contains(password, candidate) || strings.Contains(candidate, password) {
+			return true
+		}
+		if levenshtein(password, candidate) <= utf8.RuneCountInString(password)/4 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	previous := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current := make([]int, len(rb)+1)
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+
+	return previous[len(rb)]
+}
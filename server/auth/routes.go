@@ -1,9 +1,58 @@
 package auth
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/Jesuloba-world/social-sum/server/middleware"
+	"github.com/Jesuloba-world/social-sum/server/rbac"
+)
 
 func Router(app *fiber.App) {
+	guard = newLoginGuard()
+	passkeyAuth = newPasskeyService(newRelyingParty(), mongoPasskeyStore{})
+
 	api := app.Group("/auth")
 	api.Post("/signup", validateSignup, signup)
 	api.Post("/login", validateLogin, login)
+	api.Post("/magic-link", validateMagicLink, magicLink)
+	api.Get("/magic-link/verify", verifyMagicLink)
+	api.Post("/passkeys/login/begin", beginPasskeyLogin)
+	api.Post("/passkeys/login/finish", validatePasskeyLogin, finishPasskeyLogin)
+
+	// account management needs a login session, personal access tokens are rejected
+	api.Patch("/users/:userId/role", middleware.IsAuth, middleware.RequireSession, middleware.RequirePermission(rbac.PermissionManageRoles), validateUpdateRole, updateRole)
+	api.Get("/audit-log", middleware.IsAuth, middleware.RequireSession, middleware.RequirePermission(rbac.PermissionViewAuditLog), getAuditLog)
+	api.Post("/unlock", middleware.IsAuth, middleware.RequireSession, middleware.RequirePermission(rbac.PermissionUnlockLogins), validateUnlock, unlock)
+
+	api.Get("/sessions", middleware.IsAuth, middleware.RequireSession, getSessions)
+	api.Delete("/sessions", middleware.IsAuth, middleware.RequireSession, revokeAllSessions)
+	api.Delete("/sessions/:sessionId", middleware.IsAuth, middleware.RequireSession, revokeSession)
+
+	api.Post("/tokens", middleware.IsAuth, middleware.RequireSession, validateCreateAccessToken, createAccessToken)
+	api.Get("/tokens", middleware.IsAuth, middleware.RequireSession, getAccessTokens)
+	api.Delete("/tokens/:tokenId", middleware.IsAuth, middleware.RequireSession, revokeAccessToken)
+
+	api.Patch("/password", middleware.IsAuth, middleware.RequireSession, changePassword)
+	api.Post("/email", middleware.IsAuth, middleware.RequireSession, changeEmail)
+	api.Get("/email/confirm", confirmEmailChange)
+	api.Patch("/name", middleware.IsAuth, middleware.RequireSession, updateName)
+	api.Get("/status", middleware.IsAuth, middleware.RequireSession, getStatus)
+	api.Patch("/status", middleware.IsAuth, middleware.RequireSession, updateStatus)
+	api.Put("/avatar", middleware.IsAuth, middleware.RequireSession, updateAvatar)
+	api.Delete("/avatar", middleware.IsAuth, middleware.RequireSession, removeAvatar)
+	api.Put("/banner", middleware.IsAuth, middleware.RequireSession, updateBanner)
+	api.Delete("/banner", middleware.IsAuth, middleware.RequireSession, removeBanner)
+	api.Get("/muted-words", middleware.IsAuth, middleware.RequireSession, getMutedWords)
+	api.Post("/muted-words", middleware.IsAuth, middleware.RequireSession, addMutedWord)
+	api.Delete("/muted-words/:wordId", middleware.IsAuth, middleware.RequireSession, removeMutedWord)
+
+	api.Post("/passkeys/register/begin", middleware.IsAuth, middleware.RequireSession, beginPasskeyRegistration)
+	api.Post("/passkeys/register/finish", middleware.IsAuth, middleware.RequireSession, validateRegisterPasskey, finishPasskeyRegistration)
+	api.Get("/passkeys", middleware.IsAuth, middleware.RequireSession, getPasskeys)
+	api.Delete("/passkeys/:passkeyId", middleware.IsAuth, middleware.RequireSession, deletePasskey)
+
+	api.Get("/csrf", middleware.IsAuth, middleware.RequireSession, csrfToken)
+
+	// personal access tokens can open websockets too, so no RequireSession here
+	api.Post("/ws-ticket", middleware.IsAuth, wsTicket)
 }
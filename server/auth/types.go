@@ -1,17 +1,84 @@
 package auth
 
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Jesuloba-world/social-sum/server/accesstoken"
+	"github.com/Jesuloba-world/social-sum/server/rbac"
+)
+
 type Error struct {
-	Message string `json:"message"`
-	Error   string `json:"error"`
+	Message string      `json:"message"`
+	Error   string      `json:"error"`
+	Fields  FieldErrors `json:"fields,omitempty"`
 }
 
 type SignupInput struct {
 	Email    string `json:"email" validate:"required,email"`
 	Name     string `json:"name" validate:"required"`
-	Password string `json:"password" validate:"required,min=5"`
+	Password string `json:"password" validate:"required"`
 }
 
 type loginInput struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
 }
+
+type magicLinkInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type registerPasskeyInput struct {
+	CeremonyID string          `json:"ceremonyId" validate:"required"`
+	Name       string          `json:"name" validate:"max=100"`
+	Credential json.RawMessage `json:"credential" validate:"required" swaggertype:"object"`
+}
+
+type passkeyLoginInput struct {
+	CeremonyID string          `json:"ceremonyId" validate:"required"`
+	Credential json.RawMessage `json:"credential" validate:"required" swaggertype:"object"`
+}
+
+type updateRoleInput struct {
+	Role rbac.Role `json:"role" validate:"required,oneof=user moderator admin"`
+}
+
+type unlockInput struct {
+	Email string `json:"email" validate:"required_without=IP,omitempty,email"`
+	IP    string `json:"ip" validate:"required_without=Email,omitempty,ip"`
+}
+
+type createAccessTokenInput struct {
+	Name          string              `json:"name" validate:"required,max=100"`
+	Scopes        []accesstoken.Scope `json:"scopes" validate:"required,min=1,dive,oneof=feed:read feed:write"`
+	ExpiresInDays int                 `json:"expiresInDays" validate:"omitempty,min=1,max=365"`
+}
+
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required"`
+}
+
+type ChangeEmailInput struct {
+	NewEmail string `json:"newEmail" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+type UpdateNameInput struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// MutedWordInput adds a muted word. Contexts default to every context, Action to hide,
+// and a nil ExpiresAt keeps the word muted until it is removed.
+type MutedWordInput struct {
+	Phrase    string     `json:"phrase" validate:"required,max=100,printable"`
+	Contexts  []string   `json:"contexts" validate:"omitempty,dive,oneof=timeline notifications"`
+	Action    string     `json:"action" validate:"omitempty,oneof=hide collapse"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// UpdateStatusInput allows an empty status, which clears it.
+type UpdateStatusInput struct {
+	Status string `json:"status" validate:"max=140,printable"`
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"reflect"
+	"strings"
+	"unicode"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
@@ -14,6 +17,27 @@ import (
 
 var Validator = validator.New()
 
+func init() {
+	// report json field names, e.g. "email" rather than "Email"
+	Validator.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	// "printable" rejects line breaks and other control characters in single line text
+	Validator.RegisterValidation("printable", func(fl validator.FieldLevel) bool {
+		for _, r := range fl.Field().String() {
+			if !unicode.IsPrint(r) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
 func validateSignup(c *fiber.Ctx) error {
 	input := new(SignupInput)
 
@@ -26,35 +50,72 @@ func validateSignup(c *fiber.Ctx) error {
 
 	err := ValidateSignupInput(*input)
 	if err != nil {
-		c.Status(http.StatusUnprocessableEntity).JSON(Error{
-			Message: "Validation failed",
-			Error:   err.Error(),
-		})
+		if fields, ok := err.(FieldErrors); ok {
+			return c.Status(http.StatusUnprocessableEntity).JSON(Error{
+				Message: "Validation failed",
+				Error:   err.Error(),
+				Fields:  fields,
+			})
+		}
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
 	}
 
 	return c.Next()
 }
 
+// ValidateSignupInput validates a new account. Invalid input is reported as FieldErrors.
 func ValidateSignupInput(input SignupInput) error {
 	validationErr := Validator.Struct(input)
 
 	if validationErr != nil {
-		return fmt.Errorf("%s", validationErr.Error())
+		return toFieldErrors(validationErr)
+	}
+
+	err := ValidatePassword("password", input.Password, input.Email, input.Name)
+	if err != nil {
+		return err
 	}
 
 	// check
 	userCollection := database.Client.Database("Auth").Collection("User")
 	filter := bson.M{"email": input.Email}
 	result := new(User)
-	err := userCollection.FindOne(context.TODO(), filter).Decode(result)
+	err = userCollection.FindOne(context.TODO(), filter).Decode(result)
 
 	if err == nil && result.Email != "" {
-		return fmt.Errorf("validation failed: %s", "This User already exists")
+		return FieldErrors{"email": "is already registered"}
 	}
 
 	return nil
 }
 
+// toFieldErrors turns validator errors into FieldErrors keyed by json field name.
+func toFieldErrors(err error) error {
+	validationErrors, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return err
+	}
+
+	fields := FieldErrors{}
+	for _, fieldErr := range validationErrors {
+		switch fieldErr.Tag() {
+		case "required":
+			fields[fieldErr.Field()] = "is required"
+		case "email":
+			fields[fieldErr.Field()] = "must be a valid email address"
+		case "min":
+			fields[fieldErr.Field()] = fmt.Sprintf("must be at least %s characters long", fieldErr.Param())
+		case "max":
+			fields[fieldErr.Field()] = fmt.Sprintf("must be at most %s characters long", fieldErr.Param())
+		case "printable":
+			fields[fieldErr.Field()] = "must not contain line breaks or control characters"
+		default:
+			fields[fieldErr.Field()] = "is invalid"
+		}
+	}
+	return fields
+}
+
 func validateLogin(c *fiber.Ctx) error {
 	input := new(loginInput)
 
@@ -76,3 +137,135 @@ func validateLogin(c *fiber.Ctx) error {
 
 	return c.Next()
 }
+
+func validateUpdateRole(c *fiber.Ctx) error {
+	input := new(updateRoleInput)
+
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(Error{
+			Message: "An error occured",
+			Error:   err.Error(),
+		})
+	}
+
+	validationErr := Validator.Struct(input)
+
+	if validationErr != nil {
+		return c.Status(http.StatusUnprocessableEntity).JSON(Error{
+			Message: "Validation failed",
+			Error:   validationErr.Error(),
+		})
+	}
+
+	return c.Next()
+}
+
+func validateMagicLink(c *fiber.Ctx) error {
+	input := new(magicLinkInput)
+
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(Error{
+			Message: "An error occured",
+			Error:   err.Error(),
+		})
+	}
+
+	validationErr := Validator.Struct(input)
+
+	if validationErr != nil {
+		return c.Status(http.StatusUnprocessableEntity).JSON(Error{
+			Message: "Validation failed",
+			Error:   validationErr.Error(),
+		})
+	}
+
+	return c.Next()
+}
+
+func validateRegisterPasskey(c *fiber.Ctx) error {
+	input := new(registerPasskeyInput)
+
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(Error{
+			Message: "An error occured",
+			Error:   err.Error(),
+		})
+	}
+
+	validationErr := Validator.Struct(input)
+
+	if validationErr != nil {
+		return c.Status(http.StatusUnprocessableEntity).JSON(Error{
+			Message: "Validation failed",
+			Error:   validationErr.Error(),
+		})
+	}
+
+	return c.Next()
+}
+
+func validatePasskeyLogin(c *fiber.Ctx) error {
+	input := new(passkeyLoginInput)
+
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(Error{
+			Message: "An error occured",
+			Error:   err.Error(),
+		})
+	}
+
+	validationErr := Validator.Struct(input)
+
+	if validationErr != nil {
+		return c.Status(http.StatusUnprocessableEntity).JSON(Error{
+			Message: "Validation failed",
+			Error:   validationErr.Error(),
+		})
+	}
+
+	return c.Next()
+}
+
+func validateUnlock(c *fiber.Ctx) error {
+	input := new(unlockInput)
+
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(Error{
+			Message: "An error occured",
+			Error:   err.Error(),
+		})
+	}
+
+	validationErr := Validator.Struct(input)
+
+	if validationErr != nil {
+		return c.Status(http.StatusUnprocessableEntity).JSON(Error{
+			Message: "Validation failed",
+			Error:   validationErr.Error(),
+		})
+	}
+
+	return c.Next()
+}
+
+func validateCreateAccessToken(c *fiber.Ctx) error {
+	input := new(createAccessTokenInput)
+
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(Error{
+			Message: "An error occured",
+			Error:   err.Error(),
+		})
+	}
+
+	validationErr := Validator.Struct(input)
+
+	if validationErr != nil {
+		return c.Status(http.StatusUnprocessableEntity).JSON(Error{
+			Message: "Validation failed",
+			Error:   validationErr.Error(),
+		})
+	}
+
+	return c.Next()
+}
@@ -0,0 +1,188 @@
+package feed
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Jesuloba-world/social-sum/server/auth"
+	"github.com/Jesuloba-world/social-sum/server/database"
+)
+
+// Bookmark is a post a user saved for later. Only the user can see their bookmarks.
+type Bookmark struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	PostID    primitive.ObjectID `bson:"postId" json:"postId"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+func bookmarkCollection() *mongo.Collection {
+	return database.Client.Database("Feed").Collection("Bookmark")
+}
+
+// ensureBookmarkIndexes allows one bookmark of a post per user, and indexes bookmarks by user, newest first, and by post for cleanups.
+func ensureBookmarkIndexes() error {
+	_, err := bookmarkCollection().Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "postId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.M{"postId": 1}},
+	})
+	return err
+}
+
+// AddBookmark saves the post for the user. Saving a post twice has no effect.
+func AddBookmark(userId, postId primitive.ObjectID) error {
+	bookmark := Bookmark{UserID: userId, PostID: postId, CreatedAt: time.Now()}
+
+	_, err := bookmarkCollection().InsertOne(context.TODO(), bookmark)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	return nil
+}
+
+// RemoveBookmark unsaves the post for the user, if they saved it.
+func RemoveBookmark(userId, postId primitive.ObjectID) error {
+	_, err := bookmarkCollection().DeleteOne(context.TODO(), bson.M{"userId": userId, "postId": postId})
+	return err
+}
+
+// IsBookmarked reports whether the user saved the post.
+func IsBookmarked(userId, postId primitive.ObjectID) (bool, error) {
+	count, err := bookmarkCollection().CountDocuments(context.TODO(), bson.M{"userId": userId, "postId": postId}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// fillBookmarked marks the posts viewerId saved.
+func fillBookmarked(viewerId primitive.ObjectID, posts []Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	postIds := make([]primitive.ObjectID, len(posts))
+	for i, post := range posts {
+		postIds[i] = post.ID
+	}
+
+	opts := options.Find().SetProjection(bson.M{"postId": 1})
+	cursor, err := bookmarkCollection().Find(context.TODO(), bson.M{"userId": viewerId, "postId": bson.M{"$in": postIds}}, opts)
+	if err != nil {
+		return err
+	}
+
+	var bookmarks []Bookmark
+	if err := cursor.All(context.TODO(), &bookmarks); err != nil {
+		return err
+	}
+
+	saved := make(map[primitive.ObjectID]bool, len(bookmarks))
+	for _, bookmark := range bookmarks {
+		saved[bookmark.PostID] = true
+	}
+
+	for i := range posts {
+		posts[i].Bookmarked = saved[posts[i].ID]
+	}
+	return nil
+}
+
+// FindBookmarks returns one page of the posts viewer saved, most recently saved first, and the
+// total number of them. Pages start at 1. Posts viewer can't see any more, because of a block,
+// a mute or a muted word, are neither on the page nor counted.
+func FindBookmarks(viewer *auth.User, page, limit int) ([]Post, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	hidden, err := hiddenCreators(viewer)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// hidden posts are left out before paging, so pages are full and the total is exact
+	visible := bson.M{"post.0": bson.M{"$exists": true}, "post.creator": bson.M{"$nin": hidden}}
+	if muted := auth.MutedWordsRegex(viewer.ActiveMutedWords(auth.MutedWordContextTimeline, auth.MutedWordActionHide)); muted != nil {
+		visible["$nor"] = bson.A{bson.M{"post.title": muted}, bson.M{"post.content": muted}}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"userId": viewer.ID}}},
+		{{Key: "$sort", Value: bson.M{"_id": -1}}},
+		{{Key: "$lookup", Value: bson.M{"from": "Post", "localField": "postId", "foreignField": "_id", "as": "post"}}},
+		{{Key: "$match", Value: visible}},
+		{{Key: "$facet", Value: bson.M{
+			"page":  bson.A{bson.M{"$skip": (page - 1) * limit}, bson.M{"$limit": limit}, bson.M{"$project": bson.M{"postId": 1}}},
+			"total": bson.A{bson.M{"$count": "count"}},
+		}}},
+	}
+
+	cursor, err := bookmarkCollection().Aggregate(context.TODO(), pipeline)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var results []struct {
+		Page  []Bookmark `bson:"page"`
+		Total []struct {
+			Count int64 `bson:"count"`
+		} `bson:"total"`
+	}
+	if err := cursor.All(context.TODO(), &results); err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	if len(results[0].Total) > 0 {
+		total = results[0].Total[0].Count
+	}
+	bookmarks := results[0].Page
+
+	if len(bookmarks) == 0 {
+		return []Post{}, total, nil
+	}
+
+	postIds := make([]primitive.ObjectID, len(bookmarks))
+	for i, bookmark := range bookmarks {
+		postIds[i] = bookmark.PostID
+	}
+
+	found, _, err := findVisiblePosts(viewer, auth.MutedWordContextTimeline, bson.M{"_id": bson.M{"$in": postIds}}, 1, len(postIds))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// posts come back newest first, and are put back in the order they were saved
+	byId := make(map[primitive.ObjectID]Post, len(found))
+	for _, post := range found {
+		byId[post.ID] = post
+	}
+
+	posts := make([]Post, 0, len(found))
+	for _, postId := range postIds {
+		if post, ok := byId[postId]; ok {
+			posts = append(posts, post)
+		}
+	}
+
+	return posts, total, nil
+}
+
+// deletePostBookmarks removes every bookmark of a deleted post.
+func deletePostBookmarks(postId primitive.ObjectID) error {
+	_, err := bookmarkCollection().DeleteMany(context.TODO(), bson.M{"postId": postId})
+	return err
+}
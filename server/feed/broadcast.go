@@ -2,25 +2,176 @@ package feed
 
 import (
 	"log"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/gofiber/contrib/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Jesuloba-world/social-sum/server/accesstoken"
+	"github.com/Jesuloba-world/social-sum/server/auth"
+	"github.com/Jesuloba-world/social-sum/server/session"
+	"github.com/Jesuloba-world/social-sum/server/social"
 )
 
+// sweepInterval is how often open connections are checked for expired or revoked logins.
+const sweepInterval = 30 * time.Second
+
+// Client is one websocket connection, and who it was authenticated as.
+// SessionID or TokenID is set, depending on how the user authenticated.
 type Client struct {
-	Closed bool
-	mu     sync.Mutex
+	Conn      *websocket.Conn
+	UserID    string
+	SessionID string
+	TokenID   string
+	ExpiresAt time.Time
+	Closed    bool
+	// viewer holds the user's blocks, mutes and muted words, which decide what posts they are sent
+	viewer *auth.User
+	// hidden and collapsed are the viewer's muted words for live updates, compiled by setViewer
+	hidden    *auth.MutedWordMatcher
+	collapsed *auth.MutedWordMatcher
+	mu        sync.Mutex
+}
+
+func newClient(c *websocket.Conn) *Client {
+	client := &Client{Conn: c}
+	client.UserID, _ = c.Locals("user_id").(string)
+	client.SessionID, _ = c.Locals("session_id").(string)
+	client.TokenID, _ = c.Locals("token_id").(string)
+	client.ExpiresAt, _ = c.Locals("auth_expires_at").(time.Time)
+
+	if userId, err := primitive.ObjectIDFromHex(client.UserID); err == nil {
+		if user, err := auth.FindUser(userId); err == nil {
+			client.setViewer(user)
+		}
+	}
+	return client
+}
+
+// close sends a close frame with the reason and closes the connection. It is safe to call more than once.
+func (client *Client) close(code int, reason string) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.Closed {
+		return
+	}
+	client.Closed = true
+
+	client.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	client.Conn.Close()
+}
+
+// setViewer replaces the client's user and compiles their muted words. The caller holds client.mu,
+// unless the client isn't registered yet.
+func (client *Client) setViewer(user *auth.User) {
+	client.viewer = user
+	client.hidden = auth.NewMutedWordMatcher(user.ActiveMutedWords(auth.MutedWordContextTimeline, auth.MutedWordActionHide))
+	client.collapsed = auth.NewMutedWordMatcher(user.ActiveMutedWords(auth.MutedWordContextTimeline, auth.MutedWordActionCollapse))
+}
+
+// filter returns msg as the client's user should see it, and false if they mustn't see it at all.
+func (client *Client) filter(msg broadcastPostType) (broadcastPostType, bool) {
+	if client.viewer == nil {
+		return msg, true
+	}
+
+	viewer := client.viewer
+	if slices.Contains(msg.creatorBlocked, viewer.ID) {
+		return msg, false
+	}
+
+	if msg.Comment != nil {
+		return msg, !viewer.Hides(msg.Comment.CreatorId)
+	}
+
+	if msg.Post == nil {
+		return msg, true
+	}
+
+	if viewer.Hides(msg.Post.CreatorId) {
+		return msg, false
+	}
+
+	// the post is shared by every client, so it's copied before being changed
+	if original := msg.Post.Original; original != nil && original.Tombstone == "" && viewer.Hides(original.CreatorId) {
+		post := *msg.Post
+		post.Original = &Post{ID: original.ID, Tombstone: tombstoneUnavailable}
+		msg.Post = &post
+	}
+
+	// muted words that expired since they were compiled stop applying
+	if now := time.Now(); client.hidden.Expired(now) || client.collapsed.Expired(now) {
+		client.setViewer(viewer)
+	}
+
+	if client.hidden.Match(msg.Post.Title, msg.Post.Content) != nil {
+		return msg, false
+	}
+
+	if word := client.collapsed.Match(msg.Post.Title, msg.Post.Content); word != nil {
+		post := *msg.Post
+		post.Filtered = &filterMatch{Phrase: word.Phrase}
+		msg.Post = &post
+	}
+
+	return msg, true
 }
 
 type broadcastPostType struct {
-	Action string `json:"action"`
-	Post   *Post  `json:"post"`
+	Action  string         `json:"action"`
+	Post    *Post          `json:"post,omitempty"`
+	Creator *creatorUpdate `json:"creator,omitempty"`
+	Status  *statusUpdate  `json:"status,omitempty"`
+	Follow  *followUpdate  `json:"follow,omitempty"`
+	Comment *Comment       `json:"comment,omitempty"`
+	// Reactions are a post's reaction counts, sent whenever they change
+	Reactions *reactionUpdate `json:"reactions,omitempty"`
+
+	// creatorBlocked are the users blocked by the creator of the post, or of the post commented on,
+	// who aren't sent the message
+	creatorBlocked []primitive.ObjectID
+}
+
+// creatorUpdate tells clients to refresh the creator shown on a user's posts.
+type creatorUpdate struct {
+	ID        string `json:"_id"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatarUrl,omitempty"`
+}
+
+// statusUpdate tells clients that a user changed their status.
+type statusUpdate struct {
+	ID     string `json:"_id"`
+	Status string `json:"status"`
+}
+
+// followUpdate tells the two users involved that one followed or unfollowed the other.
+type followUpdate struct {
+	Follower   creator `json:"follower"`
+	FolloweeID string  `json:"followeeId"`
+}
+
+// reactionUpdate tells clients the new reaction counts of a post.
+type reactionUpdate struct {
+	PostID    string         `json:"postId"`
+	Reactions map[string]int `json:"reactions"`
+}
+
+// directMessage is a message for the connections of the given users only.
+type directMessage struct {
+	UserIDs []string
+	Message broadcastPostType
 }
 
 var (
 	broadcast  = make(chan broadcastPostType)
+	direct     = make(chan directMessage)
+	rehide     = make(chan auth.User)
 	clients    = make(map[*websocket.Conn]*Client)
-	register   = make(chan *websocket.Conn)
+	register   = make(chan *Client)
 	unregister = make(chan *websocket.Conn)
 )
 
@@ -28,33 +179,65 @@ func broadcastPost(msg broadcastPostType) {
 	broadcast <- msg
 }
 
+// sendToUsers sends msg to every connection of the given users.
+func sendToUsers(userIds []string, msg broadcastPostType) {
+	direct <- directMessage{UserIDs: userIds, Message: msg}
+}
+
+// send writes msg to one client, closing the connection if the write fails.
+// BroadcastHandler's read then fails, and unregisters it.
+func send(client *Client, msg broadcastPostType) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.Closed {
+		return
+	}
+
+	msg, ok := client.filter(msg)
+	if !ok {
+		return
+	}
+
+	err := client.Conn.WriteJSON(msg)
+	if err != nil {
+		client.Closed = true
+		log.Printf("write: %s\n", err)
+		client.Conn.Close()
+	}
+}
+
 func listenToPostBroadcast() {
+	sweep := time.NewTicker(sweepInterval)
+	defer sweep.Stop()
+
 	for {
 		select {
-		case connection := <-register:
-			clients[connection] = &Client{}
-			remoteAddr := connection.RemoteAddr().String()
-			localAddr := connection.LocalAddr().String()
-			log.Printf("New WebSocket connection from %s to %s", remoteAddr, localAddr)
+		case client := <-register:
+			clients[client.Conn] = client
+			remoteAddr := client.Conn.RemoteAddr().String()
+			localAddr := client.Conn.LocalAddr().String()
+			log.Printf("New WebSocket connection from %s to %s for user %s", remoteAddr, localAddr, client.UserID)
 
 		case msg := <-broadcast:
-			for connection, client := range clients {
-				go func(connection *websocket.Conn, client *Client) {
+			for _, client := range clients {
+				go send(client, msg)
+			}
+
+		case msg := <-direct:
+			for _, client := range clients {
+				if slices.Contains(msg.UserIDs, client.UserID) {
+					go send(client, msg.Message)
+				}
+			}
+
+		case user := <-rehide:
+			for _, client := range clients {
+				if client.UserID == user.ID.Hex() {
 					client.mu.Lock()
-					defer client.mu.Unlock()
-
-					if client.Closed {
-						return
-					}
-
-					err := connection.WriteJSON(msg)
-					if err != nil {
-						client.Closed = true
-						log.Printf("write: %s\n", err)
-						connection.Close()
-						unregister <- connection
-					}
-				}(connection, client)
+					client.setViewer(&user)
+					client.mu.Unlock()
+				}
 			}
 
 		case connection := <-unregister:
@@ -63,23 +246,124 @@ func listenToPostBroadcast() {
 			localAddr := connection.LocalAddr().String()
 			log.Printf("Connection disconnected from %s to %s", remoteAddr, localAddr)
 
+		case <-sweep.C:
+			snapshot := make([]*Client, 0, len(clients))
+			for _, client := range clients {
+				snapshot = append(snapshot, client)
+			}
+			// the lookups hit the database, so they mustn't hold up broadcasts
+			go closeStaleClients(snapshot)
+		}
+	}
+}
+
+// closeStaleClients closes the connections whose token has expired, or whose session
+// or access token has been revoked since they connected.
+func closeStaleClients(snapshot []*Client) {
+	now := time.Now()
+
+	var sessionIds, tokenIds []primitive.ObjectID
+	for _, client := range snapshot {
+		if !client.ExpiresAt.IsZero() && now.After(client.ExpiresAt) {
+			client.close(websocket.ClosePolicyViolation, "token expired")
+			continue
+		}
+		if id, err := primitive.ObjectIDFromHex(client.SessionID); err == nil {
+			sessionIds = append(sessionIds, id)
+		}
+		if id, err := primitive.ObjectIDFromHex(client.TokenID); err == nil {
+			tokenIds = append(tokenIds, id)
+		}
+	}
+
+	activeSessions := map[primitive.ObjectID]bool{}
+	if len(sessionIds) > 0 {
+		active, err := session.Active(sessionIds)
+		if err != nil {
+			log.Printf("sweep sessions: %s\n", err)
+			return
+		}
+		activeSessions = active
+	}
+
+	activeTokens := map[primitive.ObjectID]bool{}
+	if len(tokenIds) > 0 {
+		active, err := accesstoken.Active(tokenIds)
+		if err != nil {
+			log.Printf("sweep access tokens: %s\n", err)
+			return
+		}
+		activeTokens = active
+	}
+
+	for _, client := range snapshot {
+		if id, err := primitive.ObjectIDFromHex(client.SessionID); err == nil && !activeSessions[id] {
+			client.close(websocket.ClosePolicyViolation, "session revoked")
+		}
+		if id, err := primitive.ObjectIDFromHex(client.TokenID); err == nil && !activeTokens[id] {
+			client.close(websocket.ClosePolicyViolation, "access token revoked")
 		}
 	}
 }
 
+// BroadcastHandler must be mounted behind middleware.WebsocketAuth.
 func BroadcastHandler(c *websocket.Conn) {
+	client := newClient(c)
+
 	defer func() {
+		client.close(websocket.CloseNormalClosure, "")
 		unregister <- c
-		c.Close()
 	}()
 
 	// register the client
-	register <- c
+	register <- client
 
-	select {}
+	// clients don't send anything, reading only notices when the connection is closed,
+	// either by the client or by closeStaleClients
+	for {
+		if _, _, err := c.ReadMessage(); err != nil {
+			return
+		}
+	}
 }
 
 func init() {
 	// listen for messages on the broadcast channel
 	go listenToPostBroadcast()
+
+	// creator names and avatars are looked up when posts are read, so only connected clients need telling
+	auth.OnUserUpdate(func(update auth.UserUpdate) {
+		user := update.User
+		if slices.Contains(update.Changed, "name") || slices.Contains(update.Changed, "avatar") {
+			creator := newCreator(&user)
+			go broadcastPost(broadcastPostType{Action: "creator-update", Creator: &creatorUpdate{ID: creator.ID, Name: creator.Name, AvatarURL: creator.AvatarURL}})
+		}
+		if slices.Contains(update.Changed, "blocked") || slices.Contains(update.Changed, "muted") || slices.Contains(update.Changed, "mutedWords") {
+			go func() { rehide <- user }()
+		}
+		if slices.Contains(update.Changed, "status") {
+			go broadcastPost(broadcastPostType{Action: "status-update", Status: &statusUpdate{ID: user.ID.Hex(), Status: user.Status}})
+		}
+	})
+
+	// both sides of a follow are told, so every open tab of either user can update its lists and counts
+	social.OnFollow(func(event social.FollowEvent) {
+		go func() {
+			follower, err := auth.FindUser(event.FollowerID)
+			if err != nil {
+				log.Printf("follow event: %s\n", err)
+				return
+			}
+
+			action := "follow"
+			if !event.Following {
+				action = "unfollow"
+			}
+
+			sendToUsers(
+				[]string{event.FollowerID.Hex(), event.FolloweeID.Hex()},
+				broadcastPostType{Action: action, Follow: &followUpdate{Follower: newCreator(follower), FolloweeID: event.FolloweeID.Hex()}},
+			)
+		}()
+	})
 }
@@ -0,0 +1,344 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Jesuloba-world/social-sum/server/auth"
+	"github.com/Jesuloba-world/social-sum/server/database"
+)
+
+const (
+	defaultCommentPageSize = 10
+
+	// maxCommentDepth limits how deeply replies nest. Top level comments have depth 0.
+	maxCommentDepth = 8
+)
+
+var (
+	ErrCommentNotFound = errors.New("comment not found")
+	ErrCommentTooDeep  = errors.New("replies can't be nested any deeper")
+)
+
+func commentCollection() *mongo.Collection {
+	return database.Client.Database("Feed").Collection("Comment")
+}
+
+// ensureCommentIndexes indexes the top level comments of a post and the replies of a comment, oldest first.
+func ensureCommentIndexes() error {
+	_, err := commentCollection().Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "postId", Value: 1}, {Key: "parentId", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "parentId", Value: 1}, {Key: "_id", Value: 1}}},
+	})
+	return err
+}
+
+// PostComments selects the top level comments of a post, for FindComments.
+func PostComments(postId primitive.ObjectID) bson.M {
+	return bson.M{"postId": postId, "parentId": nil}
+}
+
+// CommentReplies selects the direct replies to a comment, for FindComments.
+func CommentReplies(commentId primitive.ObjectID) bson.M {
+	return bson.M{"parentId": commentId}
+}
+
+// visibleComments restricts a thread to the comments viewer may see. Deleted comments
+// are kept whoever wrote them, since they only hold the thread together.
+func visibleComments(viewer *auth.User, thread bson.M) (bson.M, error) {
+	hidden, err := hiddenCreators(viewer)
+	if err != nil {
+		return nil, err
+	}
+	if len(hidden) == 0 {
+		return thread, nil
+	}
+
+	return bson.M{"$and": bson.A{thread, bson.M{"$or": bson.A{
+		bson.M{"deleted": true},
+		bson.M{"creator": bson.M{"$nin": hidden}},
+	}}}}, nil
+}
+
+// FindComments returns one page of a thread's comments as viewer may see them, oldest first,
+// and the total number of them. Pages start at 1.
+func FindComments(viewer *auth.User, thread bson.M, page, limit int) ([]Comment, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultCommentPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	filter, err := visibleComments(viewer, thread)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().SetSkip(int64((page - 1) * limit)).SetLimit(int64(limit)).SetSort(bson.M{"_id": 1})
+
+	comments, err := findComments(filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total, err := commentCollection().CountDocuments(context.TODO(), filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return comments, total, nil
+}
+
+// FindCommentsAfter returns up to first comments of a thread that come after the comment after,
+// or from the start if after is nil. hasNext reports whether more follow.
+func FindCommentsAfter(viewer *auth.User, thread bson.M, after *primitive.ObjectID, first int) (comments []Comment, hasNext bool, total int64, err error) {
+	if first < 1 {
+		first = defaultCommentPageSize
+	}
+	if first > maxPageSize {
+		first = maxPageSize
+	}
+
+	filter, err := visibleComments(viewer, thread)
+	if err != nil {
+		return nil, false, 0, err
+	}
+
+	total, err = commentCollection().CountDocuments(context.TODO(), filter)
+	if err != nil {
+		return nil, false, 0, err
+	}
+
+	// comment ids increase with time, so they double as cursors
+	if after != nil {
+		filter = bson.M{"$and": bson.A{filter, bson.M{"_id": bson.M{"$gt": *after}}}}
+	}
+
+	// one extra comment tells whether there is a next page
+	opts := options.Find().SetLimit(int64(first + 1)).SetSort(bson.M{"_id": 1})
+
+	comments, err = findComments(filter, opts)
+	if err != nil {
+		return nil, false, 0, err
+	}
+
+	if len(comments) > first {
+		return comments[:first], true, total, nil
+	}
+	return comments, false, total, nil
+}
+
+func findComments(filter bson.M, opts *options.FindOptions) ([]Comment, error) {
+	cursor, err := commentCollection().Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	comments := []Comment{}
+	if err := cursor.All(context.TODO(), &comments); err != nil {
+		return nil, err
+	}
+
+	if err := fillCommentCreators(comments); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// fillCommentCreators sets the creator of every comment that wasn't deleted.
+func fillCommentCreators(comments []Comment) error {
+	ids := make([]primitive.ObjectID, 0, len(comments))
+	for _, comment := range comments {
+		if !comment.Deleted {
+			ids = append(ids, comment.CreatorId)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	users, err := auth.FindUsers(ids)
+	if err != nil {
+		return err
+	}
+
+	creators := make(map[primitive.ObjectID]creator, len(users))
+	for i := range users {
+		creators[users[i].ID] = newCreator(&users[i])
+	}
+
+	for i := range comments {
+		if c, ok := creators[comments[i].CreatorId]; ok && !comments[i].Deleted {
+			comments[i].Creator = &c
+		}
+	}
+	return nil
+}
+
+// FindComment returns the comment with the given id, deleted or not.
+func FindComment(commentId primitive.ObjectID) (*Comment, error) {
+	comment := new(Comment)
+	err := commentCollection().FindOne(context.TODO(), bson.M{"_id": commentId}).Decode(comment)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrCommentNotFound
+		}
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// CreateComment adds a comment by user to the post, replying to parent if it isn't nil.
+func CreateComment(postId primitive.ObjectID, parent *Comment, user *auth.User, content string) (*Comment, error) {
+	now := time.Now()
+
+	comment := &Comment{
+		PostID:    postId,
+		CreatorId: user.ID,
+		Content:   content,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if parent != nil {
+		if parent.Depth+1 > maxCommentDepth {
+			return nil, ErrCommentTooDeep
+		}
+		comment.ParentID = &parent.ID
+		comment.Depth = parent.Depth + 1
+	}
+
+	// counting the reply first, only while the parent exists, keeps DeleteComment from removing
+	// the parent under a reply that is being added
+	if parent != nil {
+		err := commentCollection().FindOneAndUpdate(context.TODO(), bson.M{"_id": parent.ID, "deleted": false}, bson.M{"$inc": bson.M{"replyCount": 1}}).Err()
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil, ErrCommentNotFound
+			}
+			return nil, err
+		}
+	}
+
+	result, err := commentCollection().InsertOne(context.TODO(), comment)
+	if err != nil {
+		if parent != nil {
+			removeReply(&parent.ID)
+		}
+		return nil, err
+	}
+	comment.ID = result.InsertedID.(primitive.ObjectID)
+
+	if err := adjustCommentCount(postId, 1); err != nil {
+		return nil, err
+	}
+
+	c := newCreator(user)
+	comment.Creator = &c
+
+	return comment, nil
+}
+
+// UpdateComment replaces the content of a comment.
+func UpdateComment(comment *Comment, content string) (*Comment, error) {
+	update := bson.M{
+		"$set": bson.M{
+			"content":   content,
+			"updatedAt": time.Now(),
+		},
+	}
+
+	updated := new(Comment)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := commentCollection().FindOneAndUpdate(context.TODO(), bson.M{"_id": comment.ID, "deleted": false}, update, opts).Decode(updated)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrCommentNotFound
+		}
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// DeleteComment deletes a comment. A comment with replies is kept as a placeholder,
+// and placeholders are removed once their last reply is.
+func DeleteComment(comment *Comment) error {
+	// the reply count is checked by the delete itself, since a reply may have been added since comment was read
+	result, err := commentCollection().DeleteOne(context.TODO(), bson.M{"_id": comment.ID, "deleted": false, "replyCount": bson.M{"$not": bson.M{"$gt": 0}}})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount > 0 {
+		if err := removeReply(comment.ParentID); err != nil {
+			return err
+		}
+	} else {
+		update := bson.M{
+			"$set": bson.M{
+				"deleted":   true,
+				"content":   "",
+				"updatedAt": time.Now(),
+			},
+		}
+		result, err := commentCollection().UpdateOne(context.TODO(), bson.M{"_id": comment.ID, "deleted": false}, update)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrCommentNotFound
+		}
+	}
+
+	return adjustCommentCount(comment.PostID, -1)
+}
+
+// removeReply decrements the reply count of the parent of a removed comment, and removes
+// the parent too if it is a placeholder left with no replies.
+func removeReply(parentId *primitive.ObjectID) error {
+	for parentId != nil {
+		parent := new(Comment)
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		err := commentCollection().FindOneAndUpdate(context.TODO(), bson.M{"_id": *parentId}, bson.M{"$inc": bson.M{"replyCount": -1}}, opts).Decode(parent)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil
+			}
+			return err
+		}
+
+		if !parent.Deleted || parent.ReplyCount > 0 {
+			return nil
+		}
+
+		if _, err := commentCollection().DeleteOne(context.TODO(), bson.M{"_id": parent.ID}); err != nil {
+			return err
+		}
+		parentId = parent.ParentID
+	}
+	return nil
+}
+
+// deletePostComments removes every comment of a deleted post.
+func deletePostComments(postId primitive.ObjectID) error {
+	_, err := commentCollection().DeleteMany(context.TODO(), bson.M{"postId": postId})
+	return err
+}
+
+func adjustCommentCount(postId primitive.ObjectID, delta int) error {
+	postCollection := database.Client.Database("Feed").Collection("Post")
+	_, err := postCollection.UpdateByID(context.TODO(), postId, bson.M{"$inc": bson.M{"commentCount": delta}})
+	return err
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
@@ -15,6 +17,9 @@ import (
 
 	"github.com/Jesuloba-world/social-sum/server/auth"
 	"github.com/Jesuloba-world/social-sum/server/database"
+	"github.com/Jesuloba-world/social-sum/server/imagestore"
+	"github.com/Jesuloba-world/social-sum/server/middleware"
+	"github.com/Jesuloba-world/social-sum/server/rbac"
 )
 
 type postSerializer struct {
@@ -42,53 +47,53 @@ type allPostSerializer struct {
 // @Failure		500		{string}	string				"Internal Server Error"
 // @Router			/feed/posts [get]
 func getPosts(c *fiber.Ctx) error {
-	postCollection := database.Client.Database("Feed").Collection("Post")
-	userCollection := database.Client.Database("Auth").Collection("User")
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
 
 	page, _ := strconv.Atoi(c.Query("page", "1"))
 	limit, _ := strconv.Atoi(c.Query("limit", "2"))
 
-	skip := (page - 1) * limit
-
-	opts := options.Find().SetLimit(int64(limit)).SetSkip(int64(skip)).SetSort(bson.D{{Key: "createdAt", Value: -1}})
-
-	// Find all documents in the collection
-	cursor, err := postCollection.Find(context.TODO(), bson.M{}, opts)
+	viewer, err := auth.FindUser(userId)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).SendString(err.Error())
 	}
 
-	defer cursor.Close(context.TODO())
-
-	var posts []Post
-
-	// Iterate over the cursor and decode each document into a Post struct
-	for cursor.Next(context.TODO()) {
-		var post Post
-		if err := cursor.Decode(&post); err != nil {
-			return c.Status(http.StatusInternalServerError).SendString(err.Error())
-		}
-		user := new(auth.User)
-		err = userCollection.FindOne(context.TODO(), bson.M{"_id": post.CreatorId}).Decode(user)
-		if err != nil {
-			return c.Status(http.StatusInternalServerError).SendString(err.Error())
-		}
-		post.Creator = creator{Name: user.Name}
-		posts = append(posts, post)
+	posts, total, err := findVisiblePosts(viewer, auth.MutedWordContextTimeline, bson.M{}, page, limit)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
 	}
 
-	// Check if any error occurred during iteration
-	if err := cursor.Err(); err != nil {
+	return c.Status(http.StatusOK).JSON(allPostSerializer{Message: "Posts fetched successfully", Posts: posts, TotalItems: total})
+}
+
+// @Summary		Get the home timeline
+// @Description	Fetches the posts of the authenticated user and the accounts they follow, newest first, with pagination
+// @Tags			Feed
+// @Produce		json
+// @Security		BearerAuth
+// @Param			page	query		int					false	"Page number"
+// @Param			limit	query		int					false	"Number of posts per page"
+// @Success		200		{object}	allPostSerializer	"Successfully fetched timeline"
+// @Failure		401		{string}	string				"Unauthorized"
+// @Failure		500		{string}	string				"Internal Server Error"
+// @Router			/feed/timeline [get]
+func getTimeline(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
 		return c.Status(http.StatusInternalServerError).SendString(err.Error())
 	}
 
-	// Get the total number of documents in the collection
-	total, err := postCollection.CountDocuments(context.TODO(), bson.M{})
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "2"))
+
+	posts, total, err := FindTimeline(userId, page, limit)
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).SendString(err.Error())
 	}
 
-	return c.Status(http.StatusOK).JSON(allPostSerializer{Message: "Posts fetched successfully", Posts: posts, TotalItems: total})
+	return c.Status(http.StatusOK).JSON(allPostSerializer{Message: "Timeline fetched successfully", Posts: posts, TotalItems: total})
 }
 
 // @Summary		Create a new post
@@ -122,14 +127,30 @@ func createPost(c *fiber.Ctx) error {
 		})
 	}
 
-	// Save the file to your server and get the URL
-	// This is just an example, adjust according to your needs
-	filePath := "./images/" + file.Filename
-	c.SaveFile(file, filePath)
-	post.ImageURL = "images/" + file.Filename
+	post.ImageURL, err = imagestore.Save(file)
+	if err != nil {
+		return sendImageError(c, err)
+	}
 
 	post.SetTimestamps()
 
+	// counters are only changed by the functions that keep them in step
+	post.CommentCount = 0
+	post.Reactions = nil
+	post.RepostCount = 0
+	post.QuoteCount = 0
+
+	// reposts and quote posts have their own endpoints
+	post.Type = PostTypePost
+	post.OriginalID = nil
+
+	post.Tags = extractHashtags(post.Title, post.Content)
+
+	post.Mentions, err = resolveMentions(post.Content)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
 	// add user_id as post creator
 	userId, err := getUserIdFromLocals(c)
 	if err != nil {
@@ -175,11 +196,16 @@ func createPost(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).SendString(err.Error())
 	}
 
-	insertedPost.Creator = creator{Name: user.Name}
+	// the post exists either way, a timeline that misses it only shows it late
+	if err := fanOutPost(insertedPost, user); err != nil {
+		slog.Error(fmt.Sprintf("could not add post %s to timelines: %s", insertedPost.ID.Hex(), err.Error()))
+	}
+
+	insertedPost.Creator = newCreator(user)
 
-	broadcastPost(broadcastPostType{Action: "create", Post: insertedPost})
+	broadcastPost(broadcastPostType{Action: "create", Post: insertedPost, creatorBlocked: user.Blocked})
 
-	return c.Status(http.StatusCreated).JSON(postSerializer{Message: "Post created successfully", Post: insertedPost, Creator: &creator{Name: user.Name}})
+	return c.Status(http.StatusCreated).JSON(postSerializer{Message: "Post created successfully", Post: insertedPost, Creator: &insertedPost.Creator})
 }
 
 // @Summary		Get a specific post
@@ -218,7 +244,28 @@ func getPost(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).SendString(err.Error())
 	}
 
-	post.Creator = creator{Name: user.Name}
+	// blocked users are told the post doesn't exist
+	viewerId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+	if user.HasBlocked(viewerId) {
+		return c.Status(http.StatusNotFound).SendString("Post not found")
+	}
+
+	post.Creator = newCreator(user)
+	post.normalizeType()
+
+	viewer, err := auth.FindUser(viewerId)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	posts := []Post{*post}
+	if err := fillForViewer(viewer, auth.MutedWordContextTimeline, posts); err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+	post = &posts[0]
 
 	return c.Status(http.StatusOK).JSON(postSerializer{Message: "Post fetched successfully", Post: post})
 }
@@ -261,10 +308,16 @@ func updatePost(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).SendString(err.Error())
 	}
 
-	if oldPost.CreatorId != userId {
+	// editing someone else's post requires a moderator role
+	privileged := oldPost.CreatorId != userId
+	if privileged && !middleware.GetRole(c).Can(rbac.PermissionEditAnyPost) {
 		return c.Status(http.StatusUnauthorized).SendString("Not authorized!")
 	}
 
+	if oldPost.IsShared() {
+		return c.Status(http.StatusUnprocessableEntity).SendString(ErrSharedNotEdited.Error())
+	}
+
 	post := new(Post)
 	if err := c.BodyParser(post); err != nil {
 		return c.Status(http.StatusBadRequest).SendString(err.Error())
@@ -280,15 +333,21 @@ func updatePost(c *fiber.Ctx) error {
 		}
 		post.ImageURL = c.FormValue("image")
 	} else {
-		filePath := "./images/" + file.Filename
-		c.SaveFile(file, filePath)
-		post.ImageURL = "images/" + file.Filename
+		post.ImageURL, err = imagestore.Save(file)
+		if err != nil {
+			return sendImageError(c, err)
+		}
 	}
 
 	if post.ImageURL != oldPost.ImageURL {
 		clearImage(oldPost.ImageURL)
 	}
 
+	mentions, err := resolveMentions(post.Content)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
 	post.SetTimestamps()
 
 	update := bson.M{
@@ -296,6 +355,8 @@ func updatePost(c *fiber.Ctx) error {
 			"title":     post.Title,
 			"content":   post.Content,
 			"imageUrl":  post.ImageURL,
+			"tags":      extractHashtags(post.Title, post.Content),
+			"mentions":  mentions,
 			"updatedAt": post.UpdatedAt,
 			// "creator":   post.Creator,
 		},
@@ -313,11 +374,15 @@ func updatePost(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).SendString(err.Error())
 	}
 
-	post.Creator = creator{Name: user.Name}
+	post.Creator = newCreator(user)
 
 	slog.Info(fmt.Sprintf("post with id %s updated successfully", postId))
 
-	broadcastPost(broadcastPostType{Action: "update", Post: post})
+	if privileged {
+		recordModeration(c, userId, "post.update", oldPost)
+	}
+
+	broadcastPost(broadcastPostType{Action: "update", Post: post, creatorBlocked: user.Blocked})
 
 	return c.Status(http.StatusOK).JSON(postSerializer{Message: "Post updated successfully", Post: post})
 }
@@ -346,20 +411,13 @@ func deletePost(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).SendString(err.Error())
 	}
 
-	// get user object
-	user := new(auth.User)
-	err = userCollection.FindOne(context.TODO(), bson.M{"_id": userId}).Decode(user)
-	if err != nil {
-		return c.Status(http.StatusInternalServerError).SendString(err.Error())
-	}
-
 	objectId, err := primitive.ObjectIDFromHex(postId)
 	if err != nil {
 		return c.Status(http.StatusBadRequest).SendString("Invalid Id")
 	}
 
 	deletedPost := new(Post)
-	opts := options.FindOne().SetProjection(bson.M{"_id": 1, "imageUrl": 1, "creator": 1})
+	opts := options.FindOne().SetProjection(bson.M{"_id": 1, "type": 1, "title": 1, "imageUrl": 1, "creator": 1, "originalId": 1})
 	err = postCollection.FindOne(context.TODO(), bson.M{"_id": objectId}, opts).Decode(deletedPost)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
@@ -368,10 +426,19 @@ func deletePost(c *fiber.Ctx) error {
 		return c.Status(http.StatusInternalServerError).SendString(err.Error())
 	}
 
-	if deletedPost.CreatorId != user.ID {
+	// deleting someone else's post requires a moderator role
+	privileged := deletedPost.CreatorId != userId
+	if privileged && !middleware.GetRole(c).Can(rbac.PermissionDeleteAnyPost) {
 		return c.Status(http.StatusUnauthorized).SendString("You are not authorized to delete this post")
 	}
 
+	// get the creator, whose post list has to be updated
+	user := new(auth.User)
+	err = userCollection.FindOne(context.TODO(), bson.M{"_id": deletedPost.CreatorId}).Decode(user)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
 	result, err := postCollection.DeleteOne(context.TODO(), bson.M{"_id": deletedPost.ID})
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).SendString(err.Error())
@@ -379,6 +446,27 @@ func deletePost(c *fiber.Ctx) error {
 
 	clearImage(deletedPost.ImageURL)
 
+	if err := deletePostComments(deletedPost.ID); err != nil {
+		slog.Error(fmt.Sprintf("could not remove comments of post %s: %s", deletedPost.ID.Hex(), err.Error()))
+	}
+
+	// reposts and quotes of the post are kept, and show a tombstone in its place
+	if err := releaseOriginal(deletedPost); err != nil {
+		slog.Error(fmt.Sprintf("could not update the original of post %s: %s", deletedPost.ID.Hex(), err.Error()))
+	}
+
+	if err := deletePostReactions(deletedPost.ID); err != nil {
+		slog.Error(fmt.Sprintf("could not remove reactions to post %s: %s", deletedPost.ID.Hex(), err.Error()))
+	}
+
+	if err := deletePostBookmarks(deletedPost.ID); err != nil {
+		slog.Error(fmt.Sprintf("could not remove bookmarks of post %s: %s", deletedPost.ID.Hex(), err.Error()))
+	}
+
+	if err := removeFromTimelines(deletedPost.ID); err != nil {
+		slog.Error(fmt.Sprintf("could not remove post %s from timelines: %s", deletedPost.ID.Hex(), err.Error()))
+	}
+
 	if result.DeletedCount <= 0 {
 		return c.Status(http.StatusInternalServerError).SendString("No document deleted")
 	}
@@ -414,7 +502,766 @@ func deletePost(c *fiber.Ctx) error {
 
 	slog.Info(fmt.Sprintf("post with id %s deleted successfully", postId))
 
-	broadcastPost(broadcastPostType{Action: "delete", Post: deletedPost})
+	if privileged {
+		recordModeration(c, userId, "post.delete", deletedPost)
+	}
+
+	broadcastPost(broadcastPostType{Action: "delete", Post: deletedPost, creatorBlocked: user.Blocked})
 
 	return c.Status(http.StatusOK).JSON(postSerializer{Message: "Post deleted successfully", Post: deletedPost})
 }
+
+type commentSerializer struct {
+	Message string   `json:"message"`
+	Comment *Comment `json:"comment"`
+}
+
+type allCommentSerializer struct {
+	Message    string    `json:"message"`
+	Comments   []Comment `json:"comments"`
+	TotalItems int64     `json:"totalItems"`
+}
+
+// sendPostError responds to errors returned by the comment, reaction and repost functions, and loadPostContext.
+func sendPostError(c *fiber.Ctx, err error) error {
+	switch err {
+	case ErrPostNotFound:
+		return c.Status(http.StatusNotFound).SendString("Post not found")
+	case ErrCommentNotFound:
+		return c.Status(http.StatusNotFound).SendString("Comment not found")
+	case ErrCommentTooDeep:
+		return c.Status(http.StatusUnprocessableEntity).SendString(err.Error())
+	case ErrUnknownReaction:
+		return c.Status(http.StatusBadRequest).SendString(err.Error())
+	case ErrAlreadyReposted:
+		return c.Status(http.StatusConflict).SendString(err.Error())
+	case ErrNotReposted:
+		return c.Status(http.StatusNotFound).SendString(err.Error())
+	}
+
+	return c.Status(http.StatusInternalServerError).SendString(err.Error())
+}
+
+// loadPostContext returns the authenticated user, the post and the post's creator.
+// Posts whose creator blocked the user are reported as not found.
+func loadPostContext(c *fiber.Ctx, postId primitive.ObjectID) (*auth.User, *Post, *auth.User, error) {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	viewer, err := auth.FindUser(userId)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	post, err := FindPost(postId)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	postCreator, err := auth.FindUser(post.CreatorId)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if postCreator.HasBlocked(viewer.ID) {
+		return nil, nil, nil, ErrPostNotFound
+	}
+
+	return viewer, post, postCreator, nil
+}
+
+// @Summary		Get the comments on a post
+// @Description	Fetches the top level comments on a post, oldest first, with pagination. Replies are fetched per comment
+// @Tags			Comments
+// @Produce		json
+// @Security		BearerAuth
+// @Param			postId	path		string					true	"Post ID"
+// @Param			page	query		int						false	"Page number"
+// @Param			limit	query		int						false	"Number of comments per page"
+// @Success		200		{object}	allCommentSerializer	"Successfully fetched comments"
+// @Failure		400		{string}	string					"Bad Request"
+// @Failure		404		{string}	string					"Not Found"
+// @Failure		500		{string}	string					"Internal Server Error"
+// @Router			/feed/post/{postId}/comments [get]
+func getComments(c *fiber.Ctx) error {
+	postId, err := primitive.ObjectIDFromHex(c.Params("postId"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).SendString("Invalid Id")
+	}
+
+	viewer, _, _, err := loadPostContext(c, postId)
+	if err != nil {
+		return sendPostError(c, err)
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "10"))
+
+	comments, total, err := FindComments(viewer, PostComments(postId), page, limit)
+	if err != nil {
+		return sendPostError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(allCommentSerializer{Message: "Comments fetched successfully", Comments: comments, TotalItems: total})
+}
+
+// @Summary		Get the replies to a comment
+// @Description	Fetches the direct replies to a comment, oldest first, with pagination
+// @Tags			Comments
+// @Produce		json
+// @Security		BearerAuth
+// @Param			commentId	path		string					true	"Comment ID"
+// @Param			page		query		int						false	"Page number"
+// @Param			limit		query		int						false	"Number of replies per page"
+// @Success		200			{object}	allCommentSerializer	"Successfully fetched replies"
+// @Failure		400			{string}	string					"Bad Request"
+// @Failure		404			{string}	string					"Not Found"
+// @Failure		500			{string}	string					"Internal Server Error"
+// @Router			/feed/comments/{commentId}/replies [get]
+func getReplies(c *fiber.Ctx) error {
+	commentId, err := primitive.ObjectIDFromHex(c.Params("commentId"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).SendString("Invalid Id")
+	}
+
+	comment, err := FindComment(commentId)
+	if err != nil {
+		return sendPostError(c, err)
+	}
+
+	viewer, _, _, err := loadPostContext(c, comment.PostID)
+	if err != nil {
+		return sendPostError(c, err)
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "10"))
+
+	comments, total, err := FindComments(viewer, CommentReplies(commentId), page, limit)
+	if err != nil {
+		return sendPostError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(allCommentSerializer{Message: "Replies fetched successfully", Comments: comments, TotalItems: total})
+}
+
+// @Summary		Comment on a post
+// @Description	Adds a comment to a post, or a reply to one of its comments when parentId is set
+// @Tags			Comments
+// @Accept			json
+// @Produce		json
+// @Security		BearerAuth
+// @Param			postId			path		string				true	"Post ID"
+// @Param			commentInput	body		commentInput		true	"Comment Params"
+// @Success		201				{object}	commentSerializer	"Comment created successfully"
+// @Failure		400				{string}	string				"Bad Request"
+// @Failure		404				{string}	string				"Not Found"
+// @Failure		422				{object}	Error				"Validation failed"
+// @Failure		500				{string}	string				"Internal Server Error"
+// @Router			/feed/post/{postId}/comments [post]
+func createComment(c *fiber.Ctx) error {
+	postId, err := primitive.ObjectIDFromHex(c.Params("postId"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).SendString("Invalid Id")
+	}
+
+	input := new(commentInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	// a post whose creator blocked the user is reported as not found by loadPostContext
+	user, post, postCreator, err := loadPostContext(c, postId)
+	if err != nil {
+		return sendPostError(c, err)
+	}
+
+	var parent *Comment
+	if input.ParentID != "" {
+		parentId, _ := primitive.ObjectIDFromHex(input.ParentID)
+
+		parent, err = FindComment(parentId)
+		if err != nil {
+			return sendPostError(c, err)
+		}
+		if parent.PostID != post.ID || parent.Deleted {
+			return sendPostError(c, ErrCommentNotFound)
+		}
+
+		parentCreator, err := auth.FindUser(parent.CreatorId)
+		if err != nil {
+			return sendPostError(c, err)
+		}
+		// like blocked posts, comments whose author blocked the user are reported as not found
+		if parentCreator.HasBlocked(user.ID) {
+			return sendPostError(c, ErrCommentNotFound)
+		}
+	}
+
+	comment, err := CreateComment(post.ID, parent, user, input.Content)
+	if err != nil {
+		return sendPostError(c, err)
+	}
+
+	broadcastPost(broadcastPostType{Action: "comment-create", Comment: comment, creatorBlocked: postCreator.Blocked})
+
+	return c.Status(http.StatusCreated).JSON(commentSerializer{Message: "Comment created successfully", Comment: comment})
+}
+
+// @Summary		Edit a comment
+// @Description	Replaces the content of one of the authenticated user's comments
+// @Tags			Comments
+// @Accept			json
+// @Produce		json
+// @Security		BearerAuth
+// @Param			commentId			path		string				true	"Comment ID"
+// @Param			updateCommentInput	body		updateCommentInput	true	"Comment Params"
+// @Success		200					{object}	commentSerializer	"Comment updated successfully"
+// @Failure		400					{string}	string				"Bad Request"
+// @Failure		401					{string}	string				"Unauthorized"
+// @Failure		404					{string}	string				"Not Found"
+// @Failure		422					{object}	Error				"Validation failed"
+// @Failure		500					{string}	string				"Internal Server Error"
+// @Router			/feed/comments/{commentId} [put]
+func updateComment(c *fiber.Ctx) error {
+	commentId, err := primitive.ObjectIDFromHex(c.Params("commentId"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).SendString("Invalid Id")
+	}
+
+	input := new(updateCommentInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	comment, err := FindComment(commentId)
+	if err != nil {
+		return sendPostError(c, err)
+	}
+
+	user, _, postCreator, err := loadPostContext(c, comment.PostID)
+	if err != nil {
+		return sendPostError(c, err)
+	}
+
+	// only the author can edit a comment
+	if comment.CreatorId != user.ID {
+		return c.Status(http.StatusUnauthorized).SendString("Not authorized!")
+	}
+
+	comment, err = UpdateComment(comment, input.Content)
+	if err != nil {
+		return sendPostError(c, err)
+	}
+
+	creator := newCreator(user)
+	comment.Creator = &creator
+
+	broadcastPost(broadcastPostType{Action: "comment-update", Comment: comment, creatorBlocked: postCreator.Blocked})
+
+	return c.Status(http.StatusOK).JSON(commentSerializer{Message: "Comment updated successfully", Comment: comment})
+}
+
+// @Summary		Delete a comment
+// @Description	Deletes a comment. Authors can delete their comments, and post creators any comment on their posts.
+// @Description	A comment with replies is kept as a deleted placeholder
+// @Tags			Comments
+// @Produce		json
+// @Security		BearerAuth
+// @Param			commentId	path		string				true	"Comment ID"
+// @Success		200			{object}	commentSerializer	"Comment deleted successfully"
+// @Failure		400			{string}	string				"Bad Request"
+// @Failure		401			{string}	string				"Unauthorized"
+// @Failure		404			{string}	string				"Not Found"
+// @Failure		500			{string}	string				"Internal Server Error"
+// @Router			/feed/comments/{commentId} [delete]
+func deleteComment(c *fiber.Ctx) error {
+	commentId, err := primitive.ObjectIDFromHex(c.Params("commentId"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).SendString("Invalid Id")
+	}
+
+	comment, err := FindComment(commentId)
+	if err != nil {
+		return sendPostError(c, err)
+	}
+
+	user, post, postCreator, err := loadPostContext(c, comment.PostID)
+	if err != nil {
+		return sendPostError(c, err)
+	}
+
+	if comment.CreatorId != user.ID && post.CreatorId != user.ID {
+		return c.Status(http.StatusUnauthorized).SendString("You are not authorized to delete this comment")
+	}
+
+	if err := DeleteComment(comment); err != nil {
+		return sendPostError(c, err)
+	}
+
+	// clients only need to know which comment went
+	deleted := &Comment{ID: comment.ID, PostID: comment.PostID, ParentID: comment.ParentID, CreatorId: comment.CreatorId, Deleted: true}
+
+	broadcastPost(broadcastPostType{Action: "comment-delete", Comment: deleted, creatorBlocked: postCreator.Blocked})
+
+	return c.Status(http.StatusOK).JSON(commentSerializer{Message: "Comment deleted successfully", Comment: deleted})
+}
+
+type reactionSerializer struct {
+	Message     string         `json:"message"`
+	PostID      string         `json:"postId"`
+	Reactions   map[string]int `json:"reactions"`
+	MyReactions []string       `json:"myReactions"`
+}
+
+type allReactionSerializer struct {
+	Message    string     `json:"message"`
+	Reactions  []Reaction `json:"reactions"`
+	TotalItems int64      `json:"totalItems"`
+}
+
+// @Summary		React to a post
+// @Description	Adds one of the reactions like, love, haha, wow, sad or angry to a post. A user can give several types, each once
+// @Tags			Reactions
+// @Produce		json
+// @Security		BearerAuth
+// @Param			postId	path		string				true	"Post ID"
+// @Param			type	path		string				true	"Reaction type"
+// @Success		200		{object}	reactionSerializer	"Reaction added successfully"
+// @Failure		400		{string}	string				"Bad Request"
+// @Failure		404		{string}	string				"Not Found"
+// @Failure		500		{string}	string				"Internal Server Error"
+// @Router			/feed/post/{postId}/reactions/{type} [put]
+func addReaction(c *fiber.Ctx) error {
+	return setReaction(c, true)
+}
+
+// @Summary		Remove a reaction from a post
+// @Description	Removes one of the authenticated user's reactions to a post
+// @Tags			Reactions
+// @Produce		json
+// @Security		BearerAuth
+// @Param			postId	path		string				true	"Post ID"
+// @Param			type	path		string				true	"Reaction type"
+// @Success		200		{object}	reactionSerializer	"Reaction removed successfully"
+// @Failure		400		{string}	string				"Bad Request"
+// @Failure		404		{string}	string				"Not Found"
+// @Failure		500		{string}	string				"Internal Server Error"
+// @Router			/feed/post/{postId}/reactions/{type} [delete]
+func removeReaction(c *fiber.Ctx) error {
+	return setReaction(c, false)
+}
+
+// setReaction adds or removes the user's reaction and broadcasts the post's new counts.
+func setReaction(c *fiber.Ctx, add bool) error {
+	postId, err := primitive.ObjectIDFromHex(c.Params("postId"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).SendString("Invalid Id")
+	}
+
+	user, post, postCreator, err := loadPostContext(c, postId)
+	if err != nil {
+		return sendPostError(c, err)
+	}
+
+	var counts map[string]int
+	if add {
+		counts, err = AddReaction(post.ID, user.ID, c.Params("type"))
+	} else {
+		counts, err = RemoveReaction(post.ID, user.ID, c.Params("type"))
+	}
+	if err != nil {
+		return sendPostError(c, err)
+	}
+
+	posts := []Post{{ID: post.ID, Reactions: counts}}
+	if err := fillMyReactions(user.ID, posts); err != nil {
+		return sendPostError(c, err)
+	}
+
+	broadcastPost(broadcastPostType{
+		Action:         "reaction-update",
+		Reactions:      &reactionUpdate{PostID: post.ID.Hex(), Reactions: posts[0].Reactions},
+		creatorBlocked: postCreator.Blocked,
+	})
+
+	message := "Reaction added successfully"
+	if !add {
+		message = "Reaction removed successfully"
+	}
+	return c.Status(http.StatusOK).JSON(reactionSerializer{Message: message, PostID: post.ID.Hex(), Reactions: posts[0].Reactions, MyReactions: posts[0].MyReactions})
+}
+
+// @Summary		Get the reactions to a post
+// @Description	Lists who reacted to a post and with what, newest first, with pagination. type narrows the list to one reaction
+// @Tags			Reactions
+// @Produce		json
+// @Security		BearerAuth
+// @Param			postId	path		string					true	"Post ID"
+// @Param			type	query		string					false	"Reaction type"
+// @Param			page	query		int						false	"Page number"
+// @Param			limit	query		int						false	"Number of reactions per page"
+// @Success		200		{object}	allReactionSerializer	"Successfully fetched reactions"
+// @Failure		400		{string}	string					"Bad Request"
+// @Failure		404		{string}	string					"Not Found"
+// @Failure		500		{string}	string					"Internal Server Error"
+// @Router			/feed/post/{postId}/reactions [get]
+func getReactions(c *fiber.Ctx) error {
+	postId, err := primitive.ObjectIDFromHex(c.Params("postId"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).SendString("Invalid Id")
+	}
+
+	reactionType := c.Query("type")
+	if reactionType != "" && !slices.Contains(ReactionTypes, reactionType) {
+		return sendPostError(c, ErrUnknownReaction)
+	}
+
+	viewer, post, _, err := loadPostContext(c, postId)
+	if err != nil {
+		return sendPostError(c, err)
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+
+	reactions, total, err := FindReactions(viewer, post.ID, reactionType, page, limit)
+	if err != nil {
+		return sendPostError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(allReactionSerializer{Message: "Reactions fetched successfully", Reactions: reactions, TotalItems: total})
+}
+
+// @Summary		Repost a post
+// @Description	Shares a post as it is on the authenticated user's timeline. Reposting a repost shares its original. A post can be reposted once per user
+// @Tags			Reposts
+// @Produce		json
+// @Security		BearerAuth
+// @Param			postId	path		string			true	"Post ID"
+// @Success		201		{object}	postSerializer	"Post reposted successfully"
+// @Failure		400		{string}	string			"Bad Request"
+// @Failure		404		{string}	string			"Not Found"
+// @Failure		409		{string}	string			"Already reposted"
+// @Failure		500		{string}	string			"Internal Server Error"
+// @Router			/feed/post/{postId}/repost [post]
+func repostPost(c *fiber.Ctx) error {
+	return sharePost(c, PostTypeRepost, "")
+}
+
+// @Summary		Quote a post
+// @Description	Shares a post on the authenticated user's timeline with their comment on it
+// @Tags			Reposts
+// @Accept			json
+// @Produce		json
+// @Security		BearerAuth
+// @Param			postId		path		string			true	"Post ID"
+// @Param			quoteInput	body		quoteInput		true	"Quote Params"
+// @Success		201			{object}	postSerializer	"Post quoted successfully"
+// @Failure		400			{string}	string			"Bad Request"
+// @Failure		404			{string}	string			"Not Found"
+// @Failure		422			{object}	Error			"Validation failed"
+// @Failure		500			{string}	string			"Internal Server Error"
+// @Router			/feed/post/{postId}/quote [post]
+func quotePost(c *fiber.Ctx) error {
+	input := new(quoteInput)
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).SendString(err.Error())
+	}
+
+	return sharePost(c, PostTypeQuote, input.Content)
+}
+
+// sharePost creates a repost or quote post of the post in the path, adds it to timelines and broadcasts it.
+func sharePost(c *fiber.Ctx, postType, content string) error {
+	postId, err := primitive.ObjectIDFromHex(c.Params("postId"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).SendString("Invalid Id")
+	}
+
+	user, post, _, err := loadPostContext(c, postId)
+	if err != nil {
+		return sendPostError(c, err)
+	}
+
+	// sharing a repost shares its original, which has to be visible to the user too
+	_, original, originalCreator, err := loadPostContext(c, shareTarget(post))
+	if err != nil {
+		return sendPostError(c, err)
+	}
+
+	var shared *Post
+	if postType == PostTypeRepost {
+		shared, err = CreateRepost(original, user)
+	} else {
+		shared, err = CreateQuote(original, user, content)
+	}
+	if err != nil {
+		return sendPostError(c, err)
+	}
+
+	if err := fanOutPost(shared, user); err != nil {
+		slog.Error(fmt.Sprintf("could not add post %s to timelines: %s", shared.ID.Hex(), err.Error()))
+	}
+
+	posts := []Post{*shared}
+	if err := fillOriginals(user, auth.MutedWordContextTimeline, posts); err != nil {
+		return sendPostError(c, err)
+	}
+	shared = &posts[0]
+
+	// the original was filled in for the user, and other clients mustn't get their reactions and muted words
+	broadcasted := *shared
+	if shared.Original != nil {
+		original := *shared.Original
+		original.MyReactions = nil
+		original.Filtered = nil
+		broadcasted.Original = &original
+	}
+
+	// users blocked by either creator aren't sent the post
+	blocked := append(append([]primitive.ObjectID{}, user.Blocked...), originalCreator.Blocked...)
+	broadcastPost(broadcastPostType{Action: "create", Post: &broadcasted, creatorBlocked: blocked})
+
+	message := "Post reposted successfully"
+	if postType == PostTypeQuote {
+		message = "Post quoted successfully"
+	}
+	return c.Status(http.StatusCreated).JSON(postSerializer{Message: message, Post: shared, Creator: &shared.Creator})
+}
+
+// @Summary		Undo a repost
+// @Description	Removes the authenticated user's repost of a post. The post may have been deleted since
+// @Tags			Reposts
+// @Produce		json
+// @Security		BearerAuth
+// @Param			postId	path		string			true	"ID of the reposted post"
+// @Success		200		{object}	postSerializer	"Repost removed successfully"
+// @Failure		400		{string}	string			"Bad Request"
+// @Failure		404		{string}	string			"Not Found"
+// @Failure		500		{string}	string			"Internal Server Error"
+// @Router			/feed/post/{postId}/repost [delete]
+func undoRepost(c *fiber.Ctx) error {
+	postId, err := primitive.ObjectIDFromHex(c.Params("postId"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).SendString("Invalid Id")
+	}
+
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	user, err := auth.FindUser(userId)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	repost, err := FindRepost(postId, userId)
+	if err != nil {
+		return sendPostError(c, err)
+	}
+
+	if err := DeleteRepost(repost); err != nil {
+		return sendPostError(c, err)
+	}
+
+	broadcastPost(broadcastPostType{Action: "delete", Post: repost, creatorBlocked: user.Blocked})
+
+	return c.Status(http.StatusOK).JSON(postSerializer{Message: "Repost removed successfully", Post: repost})
+}
+
+type bookmarkSerializer struct {
+	Message    string `json:"message"`
+	PostID     string `json:"postId"`
+	Bookmarked bool   `json:"bookmarked"`
+}
+
+// @Summary		Get bookmarked posts
+// @Description	Fetches the posts the authenticated user saved, most recently saved first, with pagination
+// @Tags			Bookmarks
+// @Produce		json
+// @Security		BearerAuth
+// @Param			page	query		int					false	"Page number"
+// @Param			limit	query		int					false	"Number of posts per page"
+// @Success		200		{object}	allPostSerializer	"Successfully fetched bookmarks"
+// @Failure		401		{string}	string				"Unauthorized"
+// @Failure		500		{string}	string				"Internal Server Error"
+// @Router			/feed/bookmarks [get]
+func getBookmarks(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "2"))
+
+	viewer, err := auth.FindUser(userId)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	posts, total, err := FindBookmarks(viewer, page, limit)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(http.StatusOK).JSON(allPostSerializer{Message: "Bookmarks fetched successfully", Posts: posts, TotalItems: total})
+}
+
+// @Summary		Bookmark a post
+// @Description	Saves a post for the authenticated user. Bookmarks are private
+// @Tags			Bookmarks
+// @Produce		json
+// @Security		BearerAuth
+// @Param			postId	path		string				true	"Post ID"
+// @Success		200		{object}	bookmarkSerializer	"Post bookmarked successfully"
+// @Failure		400		{string}	string				"Bad Request"
+// @Failure		404		{string}	string				"Not Found"
+// @Failure		500		{string}	string				"Internal Server Error"
+// @Router			/feed/post/{postId}/bookmark [put]
+func addBookmark(c *fiber.Ctx) error {
+	postId, err := primitive.ObjectIDFromHex(c.Params("postId"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).SendString("Invalid Id")
+	}
+
+	user, post, _, err := loadPostContext(c, postId)
+	if err != nil {
+		return sendPostError(c, err)
+	}
+
+	if err := AddBookmark(user.ID, post.ID); err != nil {
+		return sendPostError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(bookmarkSerializer{Message: "Post bookmarked successfully", PostID: post.ID.Hex(), Bookmarked: true})
+}
+
+// @Summary		Remove a bookmark
+// @Description	Unsaves a post for the authenticated user
+// @Tags			Bookmarks
+// @Produce		json
+// @Security		BearerAuth
+// @Param			postId	path		string				true	"Post ID"
+// @Success		200		{object}	bookmarkSerializer	"Bookmark removed successfully"
+// @Failure		400		{string}	string				"Bad Request"
+// @Failure		500		{string}	string				"Internal Server Error"
+// @Router			/feed/post/{postId}/bookmark [delete]
+func removeBookmark(c *fiber.Ctx) error {
+	postId, err := primitive.ObjectIDFromHex(c.Params("postId"))
+	if err != nil {
+		return c.Status(http.StatusBadRequest).SendString("Invalid Id")
+	}
+
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	// the post may be gone or hidden by now, and the bookmark can still be removed
+	if err := RemoveBookmark(userId, postId); err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(http.StatusOK).JSON(bookmarkSerializer{Message: "Bookmark removed successfully", PostID: postId.Hex(), Bookmarked: false})
+}
+
+type trendingSerializer struct {
+	Message    string        `json:"message"`
+	Tags       []TrendingTag `json:"tags"`
+	ComputedAt time.Time     `json:"computedAt"`
+}
+
+// @Summary		Get the posts with a hashtag
+// @Description	Fetches the posts tagged with a hashtag, newest first, with pagination. The tag is case insensitive and may start with #
+// @Tags			Tags
+// @Produce		json
+// @Security		BearerAuth
+// @Param			tag		path		string				true	"Hashtag"
+// @Param			page	query		int					false	"Page number"
+// @Param			limit	query		int					false	"Number of posts per page"
+// @Success		200		{object}	allPostSerializer	"Successfully fetched posts"
+// @Failure		400		{string}	string				"Bad Request"
+// @Failure		401		{string}	string				"Unauthorized"
+// @Failure		500		{string}	string				"Internal Server Error"
+// @Router			/tags/{tag}/posts [get]
+func getTagPosts(c *fiber.Ctx) error {
+	tag, ok := normalizeHashtag(c.Params("tag"))
+	if !ok {
+		return c.Status(http.StatusBadRequest).SendString("Invalid tag")
+	}
+
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "2"))
+
+	viewer, err := auth.FindUser(userId)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	posts, total, err := findVisiblePosts(viewer, auth.MutedWordContextTimeline, bson.M{"tags": tag}, page, limit)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(http.StatusOK).JSON(allPostSerializer{Message: "Posts fetched successfully", Posts: posts, TotalItems: total})
+}
+
+// @Summary		Get trending hashtags
+// @Description	Lists the hashtags used most in recent posts, with newer posts counting for more. Recomputed periodically
+// @Tags			Tags
+// @Produce		json
+// @Security		BearerAuth
+// @Param			limit	query		int					false	"Number of tags"
+// @Success		200		{object}	trendingSerializer	"Successfully fetched trending tags"
+// @Failure		401		{string}	string				"Unauthorized"
+// @Router			/tags/trending [get]
+func getTrendingTags(c *fiber.Ctx) error {
+	limit, _ := strconv.Atoi(c.Query("limit", "10"))
+
+	tags, computedAt := TrendingTags(limit)
+
+	return c.Status(http.StatusOK).JSON(trendingSerializer{Message: "Trending tags fetched successfully", Tags: tags, ComputedAt: computedAt})
+}
+
+// @Summary		Get posts mentioning the user
+// @Description	Fetches the posts that mention the authenticated user with @name, newest first, with pagination
+// @Tags			Feed
+// @Produce		json
+// @Security		BearerAuth
+// @Param			page	query		int					false	"Page number"
+// @Param			limit	query		int					false	"Number of posts per page"
+// @Success		200		{object}	allPostSerializer	"Successfully fetched mentions"
+// @Failure		401		{string}	string				"Unauthorized"
+// @Failure		500		{string}	string				"Internal Server Error"
+// @Router			/feed/mentions [get]
+func getMentions(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "2"))
+
+	viewer, err := auth.FindUser(userId)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	posts, total, err := FindMentions(viewer, page, limit)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(http.StatusOK).JSON(allPostSerializer{Message: "Mentions fetched successfully", Posts: posts, TotalItems: total})
+}
@@ -0,0 +1,170 @@
+package feed
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/Jesuloba-world/social-sum/server/database"
+)
+
+const (
+	maxHashtagLength = 100
+	maxPostHashtags  = 30
+
+	// maxTrendingTags is how many tags the trending computation keeps.
+	maxTrendingTags = 50
+
+	// defaults used when TRENDING_WINDOW, TRENDING_HALF_LIFE or TRENDING_INTERVAL aren't set
+	defaultTrendingWindow   = 24 * time.Hour
+	defaultTrendingHalfLife = 2 * time.Hour
+	defaultTrendingInterval = 5 * time.Minute
+)
+
+// hashtagPattern matches a # that doesn't continue a word, followed by the tag.
+var hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&#])#([\p{L}\p{N}_]+)`)
+
+// tagPattern is a valid tag, without its #.
+var tagPattern = regexp.MustCompile(`^[\p{L}\p{N}_]+$`)
+
+// hashtagIndexes serve the posts of a tag, newest first, and the window trending tags are computed over.
+var hashtagIndexes = []mongo.IndexModel{
+	{Keys: bson.D{{Key: "tags", Value: 1}, {Key: "createdAt", Value: -1}}},
+	{Keys: bson.M{"createdAt": -1}},
+}
+
+// normalizeHashtag returns the tag as posts are indexed by it, lowercase and without a leading #,
+// and false if it isn't a valid tag. Tags need a letter, so "#1" isn't one.
+func normalizeHashtag(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+	if len(tag) > maxHashtagLength || !tagPattern.MatchString(tag) || !strings.ContainsFunc(tag, unicode.IsLetter) {
+		return "", false
+	}
+	return tag, true
+}
+
+// extractHashtags returns the distinct tags in texts, in the order they first appear.
+func extractHashtags(texts ...string) []string {
+	tags := []string{}
+	for _, text := range texts {
+		for _, match := range hashtagPattern.FindAllStringSubmatch(text, -1) {
+			tag, ok := normalizeHashtag(match[1])
+			if !ok || slices.Contains(tags, tag) {
+				continue
+			}
+			tags = append(tags, tag)
+			if len(tags) == maxPostHashtags {
+				return tags
+			}
+		}
+	}
+	return tags
+}
+
+// TrendingTag is a tag and how fast it is being used. Each post in the window counts
+// for 1 when it is new, and half as much every half life after that.
+type TrendingTag struct {
+	Tag   string  `bson:"_id" json:"tag"`
+	Score float64 `bson:"score" json:"score"`
+	// Count is the number of posts using the tag in the window
+	Count int `bson:"count" json:"count"`
+}
+
+// trending holds the result of the last computation, shared by every request.
+var trending struct {
+	sync.RWMutex
+	tags       []TrendingTag
+	computedAt time.Time
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	duration, err := time.ParseDuration(os.Getenv(name))
+	if err != nil || duration <= 0 {
+		return fallback
+	}
+	return duration
+}
+
+// computeTrending scores the tags of the posts created within the window, highest first.
+func computeTrending(now time.Time) ([]TrendingTag, error) {
+	postCollection := database.Client.Database("Feed").Collection("Post")
+
+	window := envDuration("TRENDING_WINDOW", defaultTrendingWindow)
+	halfLife := envDuration("TRENDING_HALF_LIFE", defaultTrendingHalfLife)
+
+	// weight = 0.5 ^ (age / halfLife)
+	weight := bson.M{"$pow": bson.A{0.5, bson.M{"$divide": bson.A{
+		bson.M{"$subtract": bson.A{now, "$createdAt"}},
+		halfLife.Milliseconds(),
+	}}}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"createdAt": bson.M{"$gte": now.Add(-window)}, "tags.0": bson.M{"$exists": true}}}},
+		{{Key: "$project", Value: bson.M{"tags": 1, "weight": weight}}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.M{"_id": "$tags", "score": bson.M{"$sum": "$weight"}, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: maxTrendingTags}},
+	}
+
+	cursor, err := postCollection.Aggregate(context.TODO(), pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []TrendingTag{}
+	if err := cursor.All(context.TODO(), &tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+func refreshTrending() {
+	now := time.Now()
+
+	tags, err := computeTrending(now)
+	if err != nil {
+		slog.Error(fmt.Sprintf("could not compute trending tags: %s", err.Error()))
+		return
+	}
+
+	trending.Lock()
+	trending.tags = tags
+	trending.computedAt = now
+	trending.Unlock()
+}
+
+// StartTrending computes the trending tags, then recomputes them every TRENDING_INTERVAL in the background.
+func StartTrending() {
+	refreshTrending()
+
+	go func() {
+		ticker := time.NewTicker(envDuration("TRENDING_INTERVAL", defaultTrendingInterval))
+		defer ticker.Stop()
+
+		for range ticker.C {
+			refreshTrending()
+		}
+	}()
+}
+
+// TrendingTags returns up to limit of the most recently computed trending tags, and when they were computed.
+func TrendingTags(limit int) ([]TrendingTag, time.Time) {
+	trending.RLock()
+	defer trending.RUnlock()
+
+	if limit < 1 || limit > len(trending.tags) {
+		limit = len(trending.tags)
+	}
+	return append([]TrendingTag{}, trending.tags[:limit]...), trending.computedAt
+}
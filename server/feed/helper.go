@@ -3,11 +3,17 @@ package feed
 import (
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
 	"path/filepath"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Jesuloba-world/social-sum/server/audit"
+	"github.com/Jesuloba-world/social-sum/server/auth"
+	"github.com/Jesuloba-world/social-sum/server/imagestore"
+	"github.com/Jesuloba-world/social-sum/server/middleware"
 )
 
 func clearImage(filePath string) error {
@@ -29,6 +35,25 @@ func clearImage(filePath string) error {
 	return nil
 }
 
+// creatorAvatarWidth suits the small avatars shown next to posts.
+const creatorAvatarWidth = 128
+
+func newCreator(user *auth.User) creator {
+	return creator{ID: user.ID.Hex(), Name: user.Name, AvatarURL: user.Avatar.URL(creatorAvatarWidth)}
+}
+
+// sendImageError responds to an upload rejected by imagestore.
+func sendImageError(c *fiber.Ctx, err error) error {
+	if err == imagestore.ErrUnsupported || err == imagestore.ErrTooLarge {
+		return c.Status(http.StatusUnprocessableEntity).JSON(Error{
+			Message: "Image upload failed",
+			Errors:  err.Error(),
+		})
+	}
+
+	return c.Status(http.StatusInternalServerError).SendString(err.Error())
+}
+
 func getUserIdFromLocals(c *fiber.Ctx) (primitive.ObjectID, error) {
 	userIdInterface := c.Locals("user_id")
 	if userIdInterface != nil {
@@ -44,3 +69,19 @@ func getUserIdFromLocals(c *fiber.Ctx) (primitive.ObjectID, error) {
 	}
 	return primitive.NewObjectID(), fmt.Errorf("user not found")
 }
+
+// recordModeration writes an audit entry for an action taken on a post the actor does not own.
+func recordModeration(c *fiber.Ctx, actorId primitive.ObjectID, action string, post *Post) {
+	err := audit.Record(audit.Entry{
+		ActorID:    actorId,
+		ActorRole:  middleware.GetRole(c),
+		Action:     action,
+		TargetType: "post",
+		TargetID:   post.ID,
+		Details:    map[string]interface{}{"creatorId": post.CreatorId.Hex(), "title": post.Title},
+		IP:         c.IP(),
+	})
+	if err != nil {
+		slog.Error(fmt.Sprintf("could not record %s on post %s: %s", action, post.ID.Hex(), err.Error()))
+	}
+}
@@ -0,0 +1,29 @@
+package feed
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/Jesuloba-world/social-sum/server/database"
+)
+
+// EnsureIndexes creates the indexes of every feed collection. Each collection's indexes are
+// defined next to the code that reads it.
+func EnsureIndexes() error {
+	for _, ensure := range []func() error{ensurePostIndexes, ensureTimelineIndexes, ensureCommentIndexes, ensureReactionIndexes, ensureBookmarkIndexes} {
+		if err := ensure(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensurePostIndexes creates the post indexes reposts, hashtags and mentions need.
+func ensurePostIndexes() error {
+	postCollection := database.Client.Database("Feed").Collection("Post")
+
+	indexes := append([]mongo.IndexModel{repostIndex, mentionIndex}, hashtagIndexes...)
+	_, err := postCollection.Indexes().CreateMany(context.TODO(), indexes)
+	return err
+}
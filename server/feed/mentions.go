@@ -0,0 +1,88 @@
+package feed
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf16"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/Jesuloba-world/social-sum/server/auth"
+)
+
+// maxPostMentions limits how many @name occurrences of a post are resolved.
+const maxPostMentions = 50
+
+// mentionPattern matches an @ that doesn't continue a word or an email address, followed by the name.
+// Names with spaces can't be mentioned, since the mention ends at the first space.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@])@([\p{L}\p{N}_.]+)`)
+
+// mentionIndex serves the posts mentioning a user, newest first.
+var mentionIndex = mongo.IndexModel{Keys: bson.D{{Key: "mentions.userId", Value: 1}, {Key: "createdAt", Value: -1}}}
+
+// utf16Length is the length of s as JavaScript counts it.
+func utf16Length(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// resolveMentions finds the @name mentions in content and links them to users. A name
+// is matched ignoring case, and only if exactly one user has it.
+func resolveMentions(content string) ([]Mention, error) {
+	type occurrence struct {
+		name       string
+		start, end int
+	}
+
+	var occurrences []occurrence
+	names := []string{}
+	for _, match := range mentionPattern.FindAllStringSubmatchIndex(content, maxPostMentions) {
+		// a sentence can end right after a mention
+		name := strings.TrimRight(content[match[2]:match[3]], ".")
+		if name == "" {
+			continue
+		}
+
+		// the @ comes just before the name
+		at := match[2] - 1
+		occurrences = append(occurrences, occurrence{
+			name:  name,
+			start: utf16Length(content[:at]),
+			end:   utf16Length(content[:match[2]+len(name)]),
+		})
+		if !slices.Contains(names, strings.ToLower(name)) {
+			names = append(names, strings.ToLower(name))
+		}
+	}
+	if len(occurrences) == 0 {
+		return []Mention{}, nil
+	}
+
+	users, err := auth.FindUsersByName(names)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string][]auth.User, len(users))
+	for _, user := range users {
+		name := strings.ToLower(user.Name)
+		byName[name] = append(byName[name], user)
+	}
+
+	mentions := []Mention{}
+	for _, o := range occurrences {
+		matches := byName[strings.ToLower(o.name)]
+		if len(matches) != 1 {
+			continue
+		}
+		mentions = append(mentions, Mention{UserID: matches[0].ID, Name: matches[0].Name, Start: o.start, End: o.end})
+	}
+	return mentions, nil
+}
+
+// FindMentions returns one page of the posts mentioning viewer, newest first, and the total
+// number of them. Pages start at 1. Mentions are notifications, so the words muted for notifications apply.
+func FindMentions(viewer *auth.User, page, limit int) ([]Post, int64, error) {
+	return findVisiblePosts(viewer, auth.MutedWordContextNotifications, bson.M{"mentions.userId": viewer.ID}, page, limit)
+}
@@ -10,17 +10,78 @@ import (
 type (
 	Post struct {
 		ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+		Type      string             `bson:"type,omitempty" json:"type"`
 		Title     string             `bson:"title" json:"title"`
 		Content   string             `bson:"content" json:"content"`
 		ImageURL  string             `bson:"imageUrl" json:"imageUrl"`
+		Tags      []string           `bson:"tags,omitempty" json:"tags"`
+		Mentions  []Mention          `bson:"mentions,omitempty" json:"mentions"`
 		CreatorId primitive.ObjectID `bson:"creator" json:"creatorId"`
 		Creator   creator            `bson:"_" json:"creator"`
+		Filtered  *filterMatch       `bson:"-" json:"filtered,omitempty"`
+		// OriginalID is the post shared by a repost or quote post, and Original that post as
+		// the viewer sees it, or a tombstone giving the reason they can't
+		OriginalID *primitive.ObjectID `bson:"originalId,omitempty" json:"originalId,omitempty"`
+		Original   *Post               `bson:"-" json:"original,omitempty"`
+		Tombstone  string              `bson:"-" json:"tombstone,omitempty"`
+		// RepostCount and QuoteCount count the reposts and quote posts of this post
+		RepostCount int `bson:"repostCount" json:"repostCount"`
+		QuoteCount  int `bson:"quoteCount" json:"quoteCount"`
+		// CommentCount counts the comments that haven't been deleted, at any depth
+		CommentCount int `bson:"commentCount" json:"commentCount"`
+		// Reactions counts the reactions of each type; MyReactions are the viewer's own
+		Reactions   map[string]int `bson:"reactions,omitempty" json:"reactions"`
+		MyReactions []string       `bson:"-" json:"myReactions,omitempty"`
+		// Bookmarked reports whether the viewer saved the post
+		Bookmarked bool      `bson:"-" json:"bookmarked"`
+		CreatedAt  time.Time `bson:"createdAt" json:"createdAt"`
+		UpdatedAt  time.Time `bson:"updatedAt" json:"updatedAt"`
+	}
+
+	// Reaction is one user's reaction of one type to a post. A user can react with several types.
+	Reaction struct {
+		ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+		PostID    primitive.ObjectID `bson:"postId" json:"postId"`
+		UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+		User      *creator           `bson:"-" json:"user,omitempty"`
+		Type      string             `bson:"type" json:"type"`
 		CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
-		UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+	}
+
+	// Comment is a comment on a post, or a reply to another comment when ParentID is set.
+	// Deleted comments with replies are kept, without their content, so the thread stays intact.
+	Comment struct {
+		ID         primitive.ObjectID  `bson:"_id,omitempty" json:"_id"`
+		PostID     primitive.ObjectID  `bson:"postId" json:"postId"`
+		ParentID   *primitive.ObjectID `bson:"parentId" json:"parentId"`
+		Depth      int                 `bson:"depth" json:"depth"`
+		CreatorId  primitive.ObjectID  `bson:"creator" json:"creatorId"`
+		Creator    *creator            `bson:"-" json:"creator,omitempty"`
+		Content    string              `bson:"content" json:"content"`
+		ReplyCount int                 `bson:"replyCount" json:"replyCount"`
+		Deleted    bool                `bson:"deleted" json:"deleted"`
+		CreatedAt  time.Time           `bson:"createdAt" json:"createdAt"`
+		UpdatedAt  time.Time           `bson:"updatedAt" json:"updatedAt"`
+	}
+
+	// Mention links an @name in a post's content to the user. Start and End are offsets into
+	// the content in UTF-16 code units, as JavaScript counts them, and span the @ and the name.
+	Mention struct {
+		UserID primitive.ObjectID `bson:"userId" json:"userId"`
+		Name   string             `bson:"name" json:"name"`
+		Start  int                `bson:"start" json:"start"`
+		End    int                `bson:"end" json:"end"`
 	}
 
 	creator struct {
-		Name string             `json:"name"`
+		ID        string `json:"_id"`
+		Name      string `json:"name"`
+		AvatarURL string `json:"avatarUrl,omitempty"`
+	}
+
+	// filterMatch marks a post matching one of the viewer's collapsed muted words.
+	filterMatch struct {
+		Phrase string `json:"phrase"`
 	}
 )
 
@@ -0,0 +1,187 @@
+package feed
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Jesuloba-world/social-sum/server/auth"
+	"github.com/Jesuloba-world/social-sum/server/database"
+)
+
+const (
+	defaultPageSize = 2
+	maxPageSize     = 100
+)
+
+var ErrPostNotFound = errors.New("post not found")
+
+// FindPost returns the post with the given id, without its creator filled in.
+func FindPost(postId primitive.ObjectID) (*Post, error) {
+	postCollection := database.Client.Database("Feed").Collection("Post")
+
+	post := new(Post)
+	err := postCollection.FindOne(context.TODO(), bson.M{"_id": postId}).Decode(post)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrPostNotFound
+		}
+		return nil, err
+	}
+	post.normalizeType()
+
+	return post, nil
+}
+
+// FindPosts returns one page of the posts matching filter, newest first, with their
+// creators filled in, and the total number of matching posts. Pages start at 1.
+func FindPosts(filter bson.M, page, limit int) ([]Post, int64, error) {
+	postCollection := database.Client.Database("Feed").Collection("Post")
+	userCollection := database.Client.Database("Auth").Collection("User")
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	skip := (page - 1) * limit
+
+	opts := options.Find().SetLimit(int64(limit)).SetSkip(int64(skip)).SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	cursor, err := postCollection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer cursor.Close(context.TODO())
+
+	var posts []Post
+
+	// Iterate over the cursor and decode each document into a Post struct
+	for cursor.Next(context.TODO()) {
+		var post Post
+		if err := cursor.Decode(&post); err != nil {
+			return nil, 0, err
+		}
+		user := new(auth.User)
+		err = userCollection.FindOne(context.TODO(), bson.M{"_id": post.CreatorId}).Decode(user)
+		if err != nil {
+			return nil, 0, err
+		}
+		post.Creator = newCreator(user)
+		post.normalizeType()
+		posts = append(posts, post)
+	}
+
+	// Check if any error occurred during iteration
+	if err := cursor.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	total, err := postCollection.CountDocuments(context.TODO(), filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return posts, total, nil
+}
+
+// hiddenCreators returns the users whose posts viewer mustn't see in listings: those the viewer
+// blocked or muted, and those who blocked the viewer.
+func hiddenCreators(viewer *auth.User) ([]primitive.ObjectID, error) {
+	blockedBy, err := auth.BlockedBy(viewer.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	hidden := append([]primitive.ObjectID{}, viewer.Blocked...)
+	hidden = append(hidden, viewer.Muted...)
+	return append(hidden, blockedBy...), nil
+}
+
+// visibleTo restricts filter to the posts viewer may see in listings, hiding the words muted in mutedContext.
+func visibleTo(viewer *auth.User, mutedContext string, filter bson.M) (bson.M, error) {
+	hidden, err := hiddenCreators(viewer)
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := bson.A{filter}
+	if len(hidden) > 0 {
+		conditions = append(conditions, bson.M{"creator": bson.M{"$nin": hidden}})
+	}
+	if muted := auth.MutedWordsRegex(viewer.ActiveMutedWords(mutedContext, auth.MutedWordActionHide)); muted != nil {
+		conditions = append(conditions, bson.M{"$nor": bson.A{bson.M{"title": muted}, bson.M{"content": muted}}})
+	}
+
+	if len(conditions) == 1 {
+		return filter, nil
+	}
+	return bson.M{"$and": conditions}, nil
+}
+
+// collapseMuted marks the posts matching the words viewer collapses in mutedContext, for clients to show a placeholder.
+func collapseMuted(viewer *auth.User, mutedContext string, posts []Post) {
+	words := viewer.ActiveMutedWords(mutedContext, auth.MutedWordActionCollapse)
+	if len(words) == 0 {
+		return
+	}
+
+	matcher := auth.NewMutedWordMatcher(words)
+	for i := range posts {
+		if word := matcher.Match(posts[i].Title, posts[i].Content); word != nil {
+			posts[i].Filtered = &filterMatch{Phrase: word.Phrase}
+		}
+	}
+}
+
+// findVisiblePosts is FindPosts for the viewer's listings, with their blocks, mutes and the words muted
+// in mutedContext applied, and the posts filled in for them.
+func findVisiblePosts(viewer *auth.User, mutedContext string, filter bson.M, page, limit int) ([]Post, int64, error) {
+	filter, err := visibleTo(viewer, mutedContext, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	posts, total, err := FindPosts(filter, page, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	collapseMuted(viewer, mutedContext, posts)
+
+	if err := fillForViewer(viewer, mutedContext, posts); err != nil {
+		return nil, 0, err
+	}
+
+	return posts, total, nil
+}
+
+// FindUserPosts returns one page of the posts of creatorId as viewer sees them, newest first, and the
+// total number of them. Reposts and quote posts come with their originals. Pages start at 1.
+func FindUserPosts(viewer *auth.User, creatorId primitive.ObjectID, page, limit int) ([]Post, int64, error) {
+	return findVisiblePosts(viewer, auth.MutedWordContextTimeline, bson.M{"creator": creatorId}, page, limit)
+}
+
+// fillForViewer sets what depends on who views the posts: their own reactions, whether they
+// bookmarked the posts, and the shared originals as they may see them in mutedContext.
+func fillForViewer(viewer *auth.User, mutedContext string, posts []Post) error {
+	if err := fillMyReactions(viewer.ID, posts); err != nil {
+		return err
+	}
+
+	if err := fillBookmarked(viewer.ID, posts); err != nil {
+		return err
+	}
+
+	return fillOriginals(viewer, mutedContext, posts)
+}
@@ -0,0 +1,215 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Jesuloba-world/social-sum/server/auth"
+	"github.com/Jesuloba-world/social-sum/server/database"
+)
+
+const defaultReactionPageSize = 20
+
+// ReactionTypes are the reactions posts accept, in the order clients show them:
+// 👍 like, ❤️ love, 😂 haha, 😮 wow, 😢 sad and 😡 angry.
+var ReactionTypes = []string{"like", "love", "haha", "wow", "sad", "angry"}
+
+var ErrUnknownReaction = errors.New("unknown reaction type")
+
+func reactionCollection() *mongo.Collection {
+	return database.Client.Database("Feed").Collection("Reaction")
+}
+
+// ensureReactionIndexes allows one reaction of each type per user, and indexes a post's reactions by type, newest first.
+func ensureReactionIndexes() error {
+	_, err := reactionCollection().Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "postId", Value: 1}, {Key: "userId", Value: 1}, {Key: "type", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "postId", Value: 1}, {Key: "type", Value: 1}, {Key: "_id", Value: -1}}},
+	})
+	return err
+}
+
+// AddReaction records the user's reaction to the post. Reacting twice with the same type
+// has no effect. It returns the post's reaction counts.
+func AddReaction(postId, userId primitive.ObjectID, reactionType string) (map[string]int, error) {
+	if !slices.Contains(ReactionTypes, reactionType) {
+		return nil, ErrUnknownReaction
+	}
+
+	reaction := Reaction{PostID: postId, UserID: userId, Type: reactionType, CreatedAt: time.Now()}
+
+	_, err := reactionCollection().InsertOne(context.TODO(), reaction)
+	if err != nil {
+		// the unique index makes concurrent reactions safe, only one of them is counted
+		if mongo.IsDuplicateKeyError(err) {
+			return reactionCounts(postId)
+		}
+		return nil, err
+	}
+
+	return adjustReactionCount(postId, reactionType, 1)
+}
+
+// RemoveReaction removes the user's reaction of the given type, if there is one.
+// It returns the post's reaction counts.
+func RemoveReaction(postId, userId primitive.ObjectID, reactionType string) (map[string]int, error) {
+	if !slices.Contains(ReactionTypes, reactionType) {
+		return nil, ErrUnknownReaction
+	}
+
+	result, err := reactionCollection().DeleteOne(context.TODO(), bson.M{"postId": postId, "userId": userId, "type": reactionType})
+	if err != nil {
+		return nil, err
+	}
+	if result.DeletedCount == 0 {
+		return reactionCounts(postId)
+	}
+
+	return adjustReactionCount(postId, reactionType, -1)
+}
+
+// adjustReactionCount changes one counter with $inc, so concurrent reactions are all counted.
+func adjustReactionCount(postId primitive.ObjectID, reactionType string, delta int) (map[string]int, error) {
+	postCollection := database.Client.Database("Feed").Collection("Post")
+
+	post := new(Post)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"reactions": 1})
+	err := postCollection.FindOneAndUpdate(context.TODO(), bson.M{"_id": postId}, bson.M{"$inc": bson.M{"reactions." + reactionType: delta}}, opts).Decode(post)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrPostNotFound
+		}
+		return nil, err
+	}
+
+	return post.Reactions, nil
+}
+
+func reactionCounts(postId primitive.ObjectID) (map[string]int, error) {
+	post, err := FindPost(postId)
+	if err != nil {
+		return nil, err
+	}
+	return post.Reactions, nil
+}
+
+// fillMyReactions sets the reactions viewerId gave each of the posts. Posts nobody reacted to
+// get empty counts, so clients always receive an object.
+func fillMyReactions(viewerId primitive.ObjectID, posts []Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	postIds := make([]primitive.ObjectID, len(posts))
+	for i, post := range posts {
+		postIds[i] = post.ID
+	}
+
+	cursor, err := reactionCollection().Find(context.TODO(), bson.M{"postId": bson.M{"$in": postIds}, "userId": viewerId})
+	if err != nil {
+		return err
+	}
+
+	var reactions []Reaction
+	if err := cursor.All(context.TODO(), &reactions); err != nil {
+		return err
+	}
+
+	mine := make(map[primitive.ObjectID][]string, len(posts))
+	for _, reaction := range reactions {
+		mine[reaction.PostID] = append(mine[reaction.PostID], reaction.Type)
+	}
+
+	for i := range posts {
+		posts[i].MyReactions = mine[posts[i].ID]
+		if posts[i].MyReactions == nil {
+			posts[i].MyReactions = []string{}
+		}
+		slices.Sort(posts[i].MyReactions)
+
+		if posts[i].Reactions == nil {
+			posts[i].Reactions = map[string]int{}
+		}
+	}
+	return nil
+}
+
+// FindReactions returns one page of the reactions to a post, newest first, with the user who
+// reacted filled in, and the total number of them. An empty reactionType includes every type.
+// Reactions by users hidden from viewer are left out.
+func FindReactions(viewer *auth.User, postId primitive.ObjectID, reactionType string, page, limit int) ([]Reaction, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultReactionPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	filter := bson.M{"postId": postId}
+	if reactionType != "" {
+		filter["type"] = reactionType
+	}
+
+	hidden, err := hiddenCreators(viewer)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(hidden) > 0 {
+		filter["userId"] = bson.M{"$nin": hidden}
+	}
+
+	opts := options.Find().SetSkip(int64((page - 1) * limit)).SetLimit(int64(limit)).SetSort(bson.M{"_id": -1})
+
+	cursor, err := reactionCollection().Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	reactions := []Reaction{}
+	if err := cursor.All(context.TODO(), &reactions); err != nil {
+		return nil, 0, err
+	}
+
+	userIds := make([]primitive.ObjectID, len(reactions))
+	for i, reaction := range reactions {
+		userIds[i] = reaction.UserID
+	}
+
+	users, err := auth.FindUsers(userIds)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	creators := make(map[primitive.ObjectID]creator, len(users))
+	for i := range users {
+		creators[users[i].ID] = newCreator(&users[i])
+	}
+	for i := range reactions {
+		if user, ok := creators[reactions[i].UserID]; ok {
+			reactions[i].User = &user
+		}
+	}
+
+	total, err := reactionCollection().CountDocuments(context.TODO(), filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return reactions, total, nil
+}
+
+// deletePostReactions removes every reaction to a deleted post.
+func deletePostReactions(postId primitive.ObjectID) error {
+	_, err := reactionCollection().DeleteMany(context.TODO(), bson.M{"postId": postId})
+	return err
+}
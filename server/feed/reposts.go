@@ -0,0 +1,244 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Jesuloba-world/social-sum/server/auth"
+	"github.com/Jesuloba-world/social-sum/server/database"
+)
+
+// Post types. Posts created before reposts existed have no type and are regular posts.
+const (
+	PostTypePost = "post"
+	// PostTypeRepost shares another post as it is, with no content of its own.
+	PostTypeRepost = "repost"
+	// PostTypeQuote shares another post with a comment on it.
+	PostTypeQuote = "quote"
+)
+
+// Tombstones replace the original of a repost or quote post the viewer can't see.
+const (
+	tombstoneDeleted     = "deleted"
+	tombstoneUnavailable = "unavailable"
+)
+
+var (
+	ErrAlreadyReposted = errors.New("you already reposted this post")
+	ErrNotReposted     = errors.New("you haven't reposted this post")
+	ErrSharedNotEdited = errors.New("reposts and quote posts can't be edited")
+)
+
+// repostIndex allows a user to repost a post once, and quote it any number of times.
+var repostIndex = mongo.IndexModel{
+	Keys:    bson.D{{Key: "originalId", Value: 1}, {Key: "creator", Value: 1}},
+	Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"type": PostTypeRepost}),
+}
+
+// normalizeType gives posts from before reposts existed their type.
+func (p *Post) normalizeType() {
+	if p.Type == "" {
+		p.Type = PostTypePost
+	}
+}
+
+// IsShared reports whether the post is a repost or quote post of another post.
+func (p *Post) IsShared() bool {
+	return p.OriginalID != nil
+}
+
+// shareTarget returns the id of the post to share when sharing post. Sharing a repost
+// shares what was reposted, so reposts never nest.
+func shareTarget(post *Post) primitive.ObjectID {
+	if post.Type == PostTypeRepost && post.OriginalID != nil {
+		return *post.OriginalID
+	}
+	return post.ID
+}
+
+// CreateRepost reposts original for user. A user can repost a post once.
+func CreateRepost(original *Post, user *auth.User) (*Post, error) {
+	return createShared(&Post{Type: PostTypeRepost, OriginalID: &original.ID}, user, "repostCount")
+}
+
+// CreateQuote shares original for user with their comment on it.
+func CreateQuote(original *Post, user *auth.User, content string) (*Post, error) {
+	mentions, err := resolveMentions(content)
+	if err != nil {
+		return nil, err
+	}
+
+	quote := &Post{Type: PostTypeQuote, OriginalID: &original.ID, Content: content, Tags: extractHashtags(content), Mentions: mentions}
+	return createShared(quote, user, "quoteCount")
+}
+
+func createShared(post *Post, user *auth.User, counter string) (*Post, error) {
+	postCollection := database.Client.Database("Feed").Collection("Post")
+	userCollection := database.Client.Database("Auth").Collection("User")
+
+	post.CreatorId = user.ID
+	post.SetTimestamps()
+
+	result, err := postCollection.InsertOne(context.TODO(), post)
+	if err != nil {
+		// a partial unique index allows one repost of a post per user
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrAlreadyReposted
+		}
+		return nil, err
+	}
+	post.ID = result.InsertedID.(primitive.ObjectID)
+
+	update := bson.M{
+		"$push": bson.M{"posts": post.ID},
+		"$set":  bson.M{"updatedAt": time.Now()},
+	}
+	if _, err := userCollection.UpdateByID(context.TODO(), user.ID, update); err != nil {
+		return nil, err
+	}
+
+	if err := adjustShareCount(*post.OriginalID, counter, 1); err != nil {
+		return nil, err
+	}
+
+	post.Creator = newCreator(user)
+	return post, nil
+}
+
+// FindRepost returns the user's repost of the post originalId.
+func FindRepost(originalId, userId primitive.ObjectID) (*Post, error) {
+	postCollection := database.Client.Database("Feed").Collection("Post")
+
+	post := new(Post)
+	err := postCollection.FindOne(context.TODO(), bson.M{"type": PostTypeRepost, "originalId": originalId, "creator": userId}).Decode(post)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotReposted
+		}
+		return nil, err
+	}
+
+	return post, nil
+}
+
+// releaseOriginal updates the counters of the original of a deleted repost or quote post.
+func releaseOriginal(post *Post) error {
+	if !post.IsShared() {
+		return nil
+	}
+
+	counter := "repostCount"
+	if post.Type == PostTypeQuote {
+		counter = "quoteCount"
+	}
+	return adjustShareCount(*post.OriginalID, counter, -1)
+}
+
+// adjustShareCount changes a share counter of the original. Originals that were deleted are left alone.
+func adjustShareCount(originalId primitive.ObjectID, counter string, delta int) error {
+	postCollection := database.Client.Database("Feed").Collection("Post")
+	_, err := postCollection.UpdateByID(context.TODO(), originalId, bson.M{"$inc": bson.M{counter: delta}})
+	return err
+}
+
+// fillOriginals embeds the originals of the reposts and quote posts among posts, as viewer may see them
+// in mutedContext. Originals that were deleted, or that viewer can't see, are replaced by tombstones.
+func fillOriginals(viewer *auth.User, mutedContext string, posts []Post) error {
+	ids := []primitive.ObjectID{}
+	for _, post := range posts {
+		if post.IsShared() && !slices.Contains(ids, *post.OriginalID) {
+			ids = append(ids, *post.OriginalID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	originals, _, err := FindPosts(bson.M{"_id": bson.M{"$in": ids}}, 1, len(ids))
+	if err != nil {
+		return err
+	}
+
+	hidden, err := hiddenCreators(viewer)
+	if err != nil {
+		return err
+	}
+
+	collapseMuted(viewer, mutedContext, originals)
+	if err := fillMyReactions(viewer.ID, originals); err != nil {
+		return err
+	}
+	if err := fillBookmarked(viewer.ID, originals); err != nil {
+		return err
+	}
+
+	found := make(map[primitive.ObjectID]*Post, len(originals))
+	for i := range originals {
+		found[originals[i].ID] = &originals[i]
+	}
+
+	for i := range posts {
+		if !posts[i].IsShared() {
+			continue
+		}
+
+		id := *posts[i].OriginalID
+		original, ok := found[id]
+		switch {
+		case !ok:
+			posts[i].Original = &Post{ID: id, Tombstone: tombstoneDeleted}
+		case slices.Contains(hidden, original.CreatorId):
+			posts[i].Original = &Post{ID: id, Tombstone: tombstoneUnavailable}
+		default:
+			posts[i].Original = original
+		}
+	}
+	return nil
+}
+
+// FindOriginal returns the original of a repost or quote post as viewer may see it,
+// which is a tombstone if it was deleted or is hidden from viewer.
+func FindOriginal(viewer *auth.User, post Post) (*Post, error) {
+	posts := []Post{post}
+	if err := fillOriginals(viewer, auth.MutedWordContextTimeline, posts); err != nil {
+		return nil, err
+	}
+	return posts[0].Original, nil
+}
+
+// DeleteRepost removes a repost and everything attached to it.
+func DeleteRepost(repost *Post) error {
+	postCollection := database.Client.Database("Feed").Collection("Post")
+	userCollection := database.Client.Database("Auth").Collection("User")
+
+	result, err := postCollection.DeleteOne(context.TODO(), bson.M{"_id": repost.ID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotReposted
+	}
+
+	update := bson.M{
+		"$pull": bson.M{"posts": repost.ID},
+		"$set":  bson.M{"updatedAt": time.Now()},
+	}
+	if _, err := userCollection.UpdateByID(context.TODO(), repost.CreatorId, update); err != nil {
+		return err
+	}
+
+	for _, cleanup := range []func(primitive.ObjectID) error{removeFromTimelines, deletePostReactions, deletePostComments, deletePostBookmarks} {
+		if err := cleanup(repost.ID); err != nil {
+			return err
+		}
+	}
+
+	return releaseOriginal(repost)
+}
@@ -3,14 +3,42 @@ package feed
 import (
 	"github.com/gofiber/fiber/v2"
 
+	"github.com/Jesuloba-world/social-sum/server/accesstoken"
 	"github.com/Jesuloba-world/social-sum/server/middleware"
 )
 
 func Router(app *fiber.App) {
+	read := middleware.RequireScope(accesstoken.ScopeFeedRead)
+	write := middleware.RequireScope(accesstoken.ScopeFeedWrite)
+
 	api := app.Group("/feed", middleware.IsAuth)
-	api.Get("/posts", getPosts)
-	api.Post("/post", validateCreateAndUpdatePost, createPost)
-	api.Get("/post/:postId", getPost)
-	api.Put("/post/:postId", validateCreateAndUpdatePost, updatePost)
-	api.Delete("/post/:postId", deletePost)
+	api.Get("/posts", read, getPosts)
+	api.Get("/timeline", read, getTimeline)
+	api.Get("/bookmarks", read, getBookmarks)
+	api.Get("/mentions", read, getMentions)
+	api.Post("/post", write, validateCreateAndUpdatePost, createPost)
+	api.Get("/post/:postId", read, getPost)
+	api.Put("/post/:postId", write, validateCreateAndUpdatePost, updatePost)
+	api.Delete("/post/:postId", write, deletePost)
+
+	api.Get("/post/:postId/comments", read, getComments)
+	api.Post("/post/:postId/comments", write, validateComment, createComment)
+	api.Get("/comments/:commentId/replies", read, getReplies)
+	api.Put("/comments/:commentId", write, validateUpdateComment, updateComment)
+	api.Delete("/comments/:commentId", write, deleteComment)
+
+	api.Post("/post/:postId/repost", write, repostPost)
+	api.Delete("/post/:postId/repost", write, undoRepost)
+	api.Post("/post/:postId/quote", write, validateQuote, quotePost)
+
+	api.Put("/post/:postId/bookmark", write, addBookmark)
+	api.Delete("/post/:postId/bookmark", write, removeBookmark)
+
+	api.Get("/post/:postId/reactions", read, getReactions)
+	api.Put("/post/:postId/reactions/:type", write, addReaction)
+	api.Delete("/post/:postId/reactions/:type", write, removeReaction)
+
+	tags := app.Group("/tags", middleware.IsAuth)
+	tags.Get("/trending", read, getTrendingTags)
+	tags.Get("/:tag/posts", read, getTagPosts)
 }
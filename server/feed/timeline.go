@@ -0,0 +1,314 @@
+package feed
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Jesuloba-world/social-sum/server/auth"
+	"github.com/Jesuloba-world/social-sum/server/database"
+	"github.com/Jesuloba-world/social-sum/server/social"
+)
+
+// Timeline strategies, chosen with TIMELINE_STRATEGY.
+//
+// With fan-out-on-write, creating a post adds an entry to the timeline of the creator
+// and each of their followers, so reading a timeline is one indexed query.
+// With fan-out-on-read, nothing is stored and timelines are built from the posts of
+// followed accounts when they are read.
+const (
+	fanOutOnWrite = "write"
+	fanOutOnRead  = "read"
+)
+
+const (
+	// defaultFanOutLimit is used when TIMELINE_FANOUT_LIMIT isn't set. Posts of accounts
+	// with more followers than this are merged into timelines when read, even with fan-out-on-write.
+	defaultFanOutLimit = 10000
+
+	// backfillSize is how many recent posts of a newly followed account are added to the follower's timeline.
+	backfillSize = 50
+)
+
+// TimelineEntry puts a post on the timeline of the user OwnerID.
+type TimelineEntry struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	OwnerID   primitive.ObjectID `bson:"ownerId" json:"ownerId"`
+	PostID    primitive.ObjectID `bson:"postId" json:"postId"`
+	CreatorID primitive.ObjectID `bson:"creatorId" json:"creatorId"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+func timelineCollection() *mongo.Collection {
+	return database.Client.Database("Feed").Collection("Timeline")
+}
+
+// ensureTimelineIndexes indexes timelines by owner, and entries by creator and post for cleanups.
+func ensureTimelineIndexes() error {
+	_, err := timelineCollection().Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "ownerId", Value: 1}, {Key: "postId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "ownerId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "ownerId", Value: 1}, {Key: "creatorId", Value: 1}}},
+		{Keys: bson.M{"postId": 1}},
+	})
+	return err
+}
+
+func timelineStrategy() string {
+	if os.Getenv("TIMELINE_STRATEGY") == fanOutOnRead {
+		return fanOutOnRead
+	}
+	return fanOutOnWrite
+}
+
+func fanOutLimit() int {
+	limit, err := strconv.Atoi(os.Getenv("TIMELINE_FANOUT_LIMIT"))
+	if err != nil || limit < 0 {
+		return defaultFanOutLimit
+	}
+	return limit
+}
+
+// fansOutOnWrite reports whether the creator's posts are copied into their followers' timelines.
+func fansOutOnWrite(creator *auth.User) bool {
+	return timelineStrategy() == fanOutOnWrite && creator.FollowerCount <= fanOutLimit()
+}
+
+// fanOutPost adds a new post to the timelines of its creator and their followers.
+// The creator's own timeline always gets the entry, so their posts show up however
+// many followers they have.
+func fanOutPost(post *Post, creator *auth.User) error {
+	if timelineStrategy() != fanOutOnWrite {
+		return nil
+	}
+
+	owners := []primitive.ObjectID{creator.ID}
+	if fansOutOnWrite(creator) {
+		followers, err := social.FollowerIds(creator.ID)
+		if err != nil {
+			return err
+		}
+		owners = append(owners, followers...)
+	}
+
+	entries := make([]interface{}, len(owners))
+	for i, owner := range owners {
+		entries[i] = TimelineEntry{OwnerID: owner, PostID: post.ID, CreatorID: post.CreatorId, CreatedAt: post.CreatedAt}
+	}
+
+	_, err := timelineCollection().InsertMany(context.TODO(), entries, options.InsertMany().SetOrdered(false))
+	return err
+}
+
+// removeFromTimelines deletes every timeline entry of a post.
+func removeFromTimelines(postId primitive.ObjectID) error {
+	_, err := timelineCollection().DeleteMany(context.TODO(), bson.M{"postId": postId})
+	return err
+}
+
+// backfillTimeline adds the recent posts of a newly followed account to the follower's timeline.
+// Follow events are handled concurrently, so an unfollow can be pruned while the backfill of the
+// follow before it is still running. The edge is checked before and after inserting, and the
+// entries removed again if it is gone.
+func backfillTimeline(followerId primitive.ObjectID, followee *auth.User) error {
+	if !fansOutOnWrite(followee) {
+		return nil
+	}
+
+	following, err := social.IsFollowing(followerId, followee.ID)
+	if err != nil || !following {
+		return err
+	}
+
+	opts := options.Find().SetLimit(backfillSize).SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetProjection(bson.M{"_id": 1, "creator": 1, "createdAt": 1})
+
+	cursor, err := database.Client.Database("Feed").Collection("Post").Find(context.TODO(), bson.M{"creator": followee.ID}, opts)
+	if err != nil {
+		return err
+	}
+
+	var posts []Post
+	if err := cursor.All(context.TODO(), &posts); err != nil {
+		return err
+	}
+	if len(posts) == 0 {
+		return nil
+	}
+
+	entries := make([]interface{}, len(posts))
+	for i, post := range posts {
+		entries[i] = TimelineEntry{OwnerID: followerId, PostID: post.ID, CreatorID: post.CreatorId, CreatedAt: post.CreatedAt}
+	}
+
+	// entries already there from an earlier follow fail the unique index, which is fine
+	_, err = timelineCollection().InsertMany(context.TODO(), entries, options.InsertMany().SetOrdered(false))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	following, err = social.IsFollowing(followerId, followee.ID)
+	if err != nil {
+		return err
+	}
+	if !following {
+		return pruneTimeline(followerId, followee.ID)
+	}
+	return nil
+}
+
+// pruneTimeline removes an unfollowed account's posts from the former follower's timeline.
+func pruneTimeline(followerId, followeeId primitive.ObjectID) error {
+	_, err := timelineCollection().DeleteMany(context.TODO(), bson.M{"ownerId": followerId, "creatorId": followeeId})
+	return err
+}
+
+// FindTimeline returns one page of the posts of userId and the accounts they follow,
+// newest first, and the total number of them. Pages start at 1. Posts hidden from the
+// user by a block, a mute or a muted word are neither on the page nor counted.
+func FindTimeline(userId primitive.ObjectID, page, limit int) ([]Post, int64, error) {
+	viewer, err := auth.FindUser(userId)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	following, err := social.FollowingIds(userId)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if timelineStrategy() == fanOutOnRead {
+		return findVisiblePosts(viewer, auth.MutedWordContextTimeline, bson.M{"creator": bson.M{"$in": append(following, userId)}}, page, limit)
+	}
+
+	// accounts too large to fan out are read directly
+	pulled := []primitive.ObjectID{}
+	if len(following) > 0 {
+		filter := bson.M{"_id": bson.M{"$in": following}, "followerCount": bson.M{"$gt": fanOutLimit()}}
+		opts := options.Find().SetProjection(bson.M{"_id": 1})
+
+		cursor, err := database.Client.Database("Auth").Collection("User").Find(context.TODO(), filter, opts)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var large []auth.User
+		if err := cursor.All(context.TODO(), &large); err != nil {
+			return nil, 0, err
+		}
+		for _, user := range large {
+			pulled = append(pulled, user.ID)
+		}
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	hidden, err := hiddenCreators(viewer)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// hidden creators and muted words are left out before paging, so pages are full and the total is exact
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"ownerId": userId, "creatorId": bson.M{"$nin": hidden}}}},
+		{{Key: "$project", Value: bson.M{"_id": "$postId", "createdAt": 1}}},
+	}
+	if len(pulled) > 0 {
+		pipeline = append(pipeline,
+			bson.D{{Key: "$unionWith", Value: bson.M{"coll": "Post", "pipeline": bson.A{
+				bson.M{"$match": bson.M{"creator": bson.M{"$in": pulled, "$nin": hidden}}},
+				bson.M{"$project": bson.M{"_id": 1, "createdAt": 1}},
+			}}}},
+			// an account that outgrew the fan-out limit can have posts both ways
+			bson.D{{Key: "$group", Value: bson.M{"_id": "$_id", "createdAt": bson.M{"$first": "$createdAt"}}}},
+		)
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$sort", Value: bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}}})
+	if muted := auth.MutedWordsRegex(viewer.ActiveMutedWords(auth.MutedWordContextTimeline, auth.MutedWordActionHide)); muted != nil {
+		pipeline = append(pipeline,
+			bson.D{{Key: "$lookup", Value: bson.M{"from": "Post", "localField": "_id", "foreignField": "_id", "as": "post"}}},
+			bson.D{{Key: "$match", Value: bson.M{"$nor": bson.A{bson.M{"post.title": muted}, bson.M{"post.content": muted}}}}},
+		)
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$facet", Value: bson.M{
+		"page":  bson.A{bson.M{"$skip": (page - 1) * limit}, bson.M{"$limit": limit}, bson.M{"$project": bson.M{"_id": 1}}},
+		"total": bson.A{bson.M{"$count": "count"}},
+	}}})
+
+	cursor, err := timelineCollection().Aggregate(context.TODO(), pipeline)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var results []struct {
+		Page []struct {
+			ID primitive.ObjectID `bson:"_id"`
+		} `bson:"page"`
+		Total []struct {
+			Count int64 `bson:"count"`
+		} `bson:"total"`
+	}
+	if err := cursor.All(context.TODO(), &results); err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	if len(results[0].Total) > 0 {
+		total = results[0].Total[0].Count
+	}
+	if len(results[0].Page) == 0 {
+		return []Post{}, total, nil
+	}
+
+	postIds := make([]primitive.ObjectID, len(results[0].Page))
+	for i, entry := range results[0].Page {
+		postIds[i] = entry.ID
+	}
+
+	posts, _, err := findVisiblePosts(viewer, auth.MutedWordContextTimeline, bson.M{"_id": bson.M{"$in": postIds}}, 1, len(postIds))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return posts, total, nil
+}
+
+func init() {
+	// keep materialized timelines in step with the social graph
+	social.OnFollow(func(event social.FollowEvent) {
+		if timelineStrategy() != fanOutOnWrite {
+			return
+		}
+
+		go func() {
+			var err error
+			if event.Following {
+				var followee *auth.User
+				followee, err = auth.FindUser(event.FolloweeID)
+				if err == nil {
+					err = backfillTimeline(event.FollowerID, followee)
+				}
+			} else {
+				err = pruneTimeline(event.FollowerID, event.FolloweeID)
+			}
+			if err != nil {
+				slog.Error(fmt.Sprintf("could not update timeline of %s: %s", event.FollowerID.Hex(), err.Error()))
+			}
+		}()
+	})
+}
@@ -18,6 +18,20 @@ type createPostInput struct {
 	Image   imageField `json:"imageUrl" validate:"required"`
 }
 
+type commentInput struct {
+	Content string `json:"content" validate:"required,max=2000"`
+	// ParentID is the comment replied to, if any
+	ParentID string `json:"parentId" validate:"omitempty,mongodb"`
+}
+
+type updateCommentInput struct {
+	Content string `json:"content" validate:"required,max=2000"`
+}
+
+type quoteInput struct {
+	Content string `json:"content" validate:"required,max=2000"`
+}
+
 type imageField struct {
 	File *multipart.FileHeader
 	URL  string
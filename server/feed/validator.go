@@ -53,3 +53,66 @@ func validateCreateAndUpdatePost(c *fiber.Ctx) error {
 
 	return c.Next()
 }
+
+func validateComment(c *fiber.Ctx) error {
+	input := new(commentInput)
+
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(Error{
+			Message: "Validation failed, entered data is incorrect",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErr := Validator.Struct(input)
+	if validationErr != nil {
+		return c.Status(http.StatusUnprocessableEntity).JSON(Error{
+			Message: "Validation failed, entered data is incorrect",
+			Errors:  validationErr.Error(),
+		})
+	}
+
+	return c.Next()
+}
+
+func validateUpdateComment(c *fiber.Ctx) error {
+	input := new(updateCommentInput)
+
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(Error{
+			Message: "Validation failed, entered data is incorrect",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErr := Validator.Struct(input)
+	if validationErr != nil {
+		return c.Status(http.StatusUnprocessableEntity).JSON(Error{
+			Message: "Validation failed, entered data is incorrect",
+			Errors:  validationErr.Error(),
+		})
+	}
+
+	return c.Next()
+}
+
+func validateQuote(c *fiber.Ctx) error {
+	input := new(quoteInput)
+
+	if err := c.BodyParser(input); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(Error{
+			Message: "Validation failed, entered data is incorrect",
+			Errors:  err.Error(),
+		})
+	}
+
+	validationErr := Validator.Struct(input)
+	if validationErr != nil {
+		return c.Status(http.StatusUnprocessableEntity).JSON(Error{
+			Message: "Validation failed, entered data is incorrect",
+			Errors:  validationErr.Error(),
+		})
+	}
+
+	return c.Next()
+}
@@ -0,0 +1,86 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Jesuloba-world/social-sum/server/accesstoken"
+	"github.com/Jesuloba-world/social-sum/server/auth"
+	"github.com/Jesuloba-world/social-sum/server/graph/model"
+	"github.com/Jesuloba-world/social-sum/server/imagestore"
+)
+
+var errUnauthenticated = errors.New("not authenticated")
+
+// The /graphql route runs middleware.IsAuthOptional, whose fiber locals
+// are visible through the request context.
+
+func currentUserId(ctx context.Context) (primitive.ObjectID, error) {
+	userId, ok := ctx.Value("user_id").(string)
+	if !ok {
+		return primitive.ObjectID{}, errUnauthenticated
+	}
+	return primitive.ObjectIDFromHex(userId)
+}
+
+// currentSessionId is like currentUserId, but rejects personal access tokens
+// the way middleware.RequireSession does.
+func currentSessionId(ctx context.Context) (primitive.ObjectID, error) {
+	sessionId, ok := ctx.Value("session_id").(string)
+	if !ok || ctx.Value("auth_method") != "session" {
+		return primitive.ObjectID{}, errors.New("this operation requires a login session")
+	}
+	return primitive.ObjectIDFromHex(sessionId)
+}
+
+// currentUserIdWithScope is like currentUserId, but requires personal access tokens to have
+// scope the way middleware.RequireScope does. Login sessions have every scope.
+func currentUserIdWithScope(ctx context.Context, scope accesstoken.Scope) (primitive.ObjectID, error) {
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		return primitive.ObjectID{}, err
+	}
+
+	if ctx.Value("auth_method") == "access_token" {
+		scopes, _ := ctx.Value("scopes").([]accesstoken.Scope)
+		token := accesstoken.Token{Scopes: scopes}
+		if !token.HasScope(scope) {
+			return primitive.ObjectID{}, errors.New("access token is missing scope " + string(scope))
+		}
+	}
+
+	return userId, nil
+}
+
+// toUserModel is for the authenticated user's own account, see toPublicUserModel for other users.
+func toUserModel(user *auth.User) *model.User {
+	public := toPublicUserModel(user)
+	public.Email = &user.Email
+	return public
+}
+
+func toPublicUserModel(user *auth.User) *model.User {
+	return &model.User{
+		ID:             user.ID.Hex(),
+		Name:           user.Name,
+		Status:         user.Status,
+		PostCount:      len(user.Posts),
+		FollowerCount:  user.FollowerCount,
+		FollowingCount: user.FollowingCount,
+		CreatedAt:      user.CreatedAt.Format(time.RFC3339),
+		AvatarURL:      imageURL(user.Avatar, 256),
+		BannerURL:      imageURL(user.Banner, 1500),
+	}
+}
+
+// imageURL returns the variant closest to width, or nil if no image was uploaded.
+func imageURL(variants imagestore.Variants, width int) *string {
+	url := variants.URL(width)
+	if url == "" {
+		return nil
+	}
+	return &url
+}
@@ -0,0 +1,21 @@
+package graph
+
+import (
+	"github.com/vektah/gqlparser/v2/gqlerror"
+
+	"github.com/Jesuloba-world/social-sum/server/auth"
+)
+
+// validationError exposes auth.FieldErrors to clients as a "fields" extension,
+// mirroring the fields of the REST validation response.
+func validationError(err error) error {
+	fields, ok := err.(auth.FieldErrors)
+	if !ok {
+		return err
+	}
+
+	return &gqlerror.Error{
+		Message:    "Validation failed",
+		Extensions: map[string]interface{}{"fields": fields},
+	}
+}
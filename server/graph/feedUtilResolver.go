@@ -13,65 +13,154 @@ import (
 	"github.com/Jesuloba-world/social-sum/server/graph/model"
 )
 
-type PostResolver struct{ *Resolver }
+func toPostModel(post feed.Post, creator *model.User) *model.Post {
+	result := &model.Post{
+		ID:           post.ID.Hex(),
+		Type:         post.Type,
+		Title:        post.Title,
+		Content:      post.Content,
+		ImageURL:     post.ImageURL,
+		Tags:         tags(post),
+		Mentions:     mentions(post),
+		Creator:      creator,
+		CommentCount: post.CommentCount,
+		RepostCount:  post.RepostCount,
+		QuoteCount:   post.QuoteCount,
+		Reactions:    reactionCounts(post),
+		CreatedAt:    post.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:    post.UpdatedAt.Format(time.RFC3339),
+	}
+	if post.OriginalID != nil {
+		originalId := post.OriginalID.Hex()
+		result.OriginalID = &originalId
+	}
+	return result
+}
 
-func (r *PostResolver) Posts(ctx context.Context, user *model.User) ([]*model.Post, error) {
-	var posts []*model.Post
+func tags(post feed.Post) []string {
+	if post.Tags == nil {
+		return []string{}
+	}
+	return post.Tags
+}
 
-	postCollection := r.DB.Database("Feed").Collection("Post")
-	userCollection := r.DB.Database("Auth").Collection("User")
+func mentions(post feed.Post) []*model.Mention {
+	result := make([]*model.Mention, len(post.Mentions))
+	for i, mention := range post.Mentions {
+		result[i] = &model.Mention{UserID: mention.UserID.Hex(), Name: mention.Name, Start: mention.Start, End: mention.End}
+	}
+	return result
+}
 
-	postObjectIds := make([]primitive.ObjectID, len(user.Posts))
-	for i, post := range user.Posts {
-		objectId, err := primitive.ObjectIDFromHex(post.ID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to convert post Id to object Id: %s", err.Error())
-		}
-		postObjectIds[i] = objectId
+func reactionCounts(post feed.Post) []*model.ReactionCount {
+	counts := make([]*model.ReactionCount, len(feed.ReactionTypes))
+	for i, reactionType := range feed.ReactionTypes {
+		counts[i] = &model.ReactionCount{Type: reactionType, Count: post.Reactions[reactionType]}
 	}
+	return counts
+}
 
-	// find the post using object ids
-	filter := bson.M{"_id": bson.M{"$in": postObjectIds}}
-	cursor, err := postCollection.Find(ctx, filter)
+// originalPost resolves the original of a repost or quote post for the authenticated user,
+// or nil if it was deleted or is hidden from them.
+func originalPost(ctx context.Context, originalId primitive.ObjectID) (*model.Post, error) {
+	userId, err := currentUserId(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch posts: %s", err.Error())
+		return nil, err
 	}
-	defer cursor.Close(ctx)
 
-	for cursor.Next(ctx) {
-		var dbpost feed.Post
-		err := cursor.Decode(&dbpost)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode post: %s", err.Error())
-		}
+	viewer, err := auth.FindUser(userId)
+	if err != nil {
+		return nil, err
+	}
 
-		post := &model.Post{
-			ID:        dbpost.ID.Hex(),
-			Title:     dbpost.Title,
-			Content:   dbpost.Content,
-			ImageURL:  dbpost.ImageURL,
-			CreatedAt: dbpost.CreatedAt.Format(time.RFC3339),
-			UpdatedAt: dbpost.UpdatedAt.Format(time.RFC3339),
-		}
+	original, err := feed.FindOriginal(viewer, feed.Post{OriginalID: &originalId})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch post: %s", err.Error())
+	}
+	if original.Tombstone != "" {
+		return nil, nil
+	}
+
+	creator, err := auth.FindUser(original.CreatorId)
+	if err != nil {
+		return nil, err
+	}
+
+	return toPostModel(*original, toPublicUserModel(creator)), nil
+}
 
-		var dbCreator auth.User
-		filter := bson.M{"_id": dbpost.CreatorId}
-		err = userCollection.FindOne(ctx, filter).Decode(&dbCreator)
+// commentConnection resolves one page of a comment thread for the authenticated user.
+func commentConnection(ctx context.Context, thread bson.M, first *int, after *string) (*model.CommentConnection, error) {
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	viewer, err := auth.FindUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var afterId *primitive.ObjectID
+	if after != nil {
+		id, err := primitive.ObjectIDFromHex(*after)
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch creator: %s", err.Error())
+			return nil, fmt.Errorf("invalid cursor")
 		}
+		afterId = &id
+	}
+
+	pageSize := 10
+	if first != nil {
+		pageSize = *first
+	}
+
+	comments, hasNext, total, err := feed.FindCommentsAfter(viewer, thread, afterId, pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch comments: %s", err.Error())
+	}
 
-		creator := &model.User{
-			ID:     dbCreator.ID.Hex(),
-			Email:  dbCreator.Email,
-			Name:   dbCreator.Name,
-			Status: dbCreator.Status,
+	creatorIds := make([]primitive.ObjectID, len(comments))
+	for i, comment := range comments {
+		creatorIds[i] = comment.CreatorId
+	}
+
+	users, err := auth.FindUsers(creatorIds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch comments: %s", err.Error())
+	}
+
+	creators := make(map[primitive.ObjectID]*model.User, len(users))
+	for i := range users {
+		creators[users[i].ID] = toPublicUserModel(&users[i])
+	}
+
+	connection := &model.CommentConnection{
+		Edges:      make([]*model.CommentEdge, len(comments)),
+		PageInfo:   &model.PageInfo{HasNextPage: hasNext},
+		TotalCount: int(total),
+	}
+
+	for i, comment := range comments {
+		node := &model.Comment{
+			ID:         comment.ID.Hex(),
+			Content:    comment.Content,
+			Deleted:    comment.Deleted,
+			Depth:      comment.Depth,
+			ReplyCount: comment.ReplyCount,
+			CreatedAt:  comment.CreatedAt.Format(time.RFC3339),
+			UpdatedAt:  comment.UpdatedAt.Format(time.RFC3339),
+		}
+		if !comment.Deleted {
+			node.Creator = creators[comment.CreatorId]
 		}
 
-		post.Creator = creator
+		connection.Edges[i] = &model.CommentEdge{Cursor: node.ID, Node: node}
+	}
 
-		posts = append(posts, post)
+	if len(comments) > 0 {
+		connection.PageInfo.EndCursor = &connection.Edges[len(comments)-1].Cursor
 	}
 
-	return posts, nil
+	return connection, nil
 }
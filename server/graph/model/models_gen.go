@@ -2,28 +2,101 @@
 
 package model
 
+type Comment struct {
+	ID string `json:"_id"`
+	// Empty for a deleted comment, which is kept while it has replies.
+	Content string `json:"content"`
+	Deleted bool   `json:"deleted"`
+	// Null for a deleted comment.
+	Creator    *User              `json:"creator,omitempty"`
+	Depth      int                `json:"depth"`
+	ReplyCount int                `json:"replyCount"`
+	CreatedAt  string             `json:"createdAt"`
+	UpdatedAt  string             `json:"updatedAt"`
+	Replies    *CommentConnection `json:"replies"`
+}
+
+// Comments oldest first. Pass a page's endCursor as after to get the next page.
+type CommentConnection struct {
+	Edges      []*CommentEdge `json:"edges"`
+	PageInfo   *PageInfo      `json:"pageInfo"`
+	TotalCount int            `json:"totalCount"`
+}
+
+type CommentEdge struct {
+	Cursor string   `json:"cursor"`
+	Node   *Comment `json:"node"`
+}
+
+// Links an @name in a post's content to a user. Offsets count UTF-16 code units and span the @ and the name.
+type Mention struct {
+	UserID string `json:"userId"`
+	Name   string `json:"name"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+}
+
 type Mutation struct {
 }
 
+type PageInfo struct {
+	HasNextPage bool    `json:"hasNextPage"`
+	EndCursor   *string `json:"endCursor,omitempty"`
+}
+
 type Post struct {
-	ID        string `json:"_id"`
-	Title     string `json:"title"`
-	Content   string `json:"content"`
-	ImageURL  string `json:"imageUrl"`
-	Creator   *User  `json:"creator"`
-	CreatedAt string `json:"createdAt"`
-	UpdatedAt string `json:"updatedAt"`
+	ID string `json:"_id"`
+	// post, repost or quote.
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	ImageURL string `json:"imageUrl"`
+	// Hashtags in the title and content, lowercase and without #.
+	Tags []string `json:"tags"`
+	// The @name mentions in the content that resolved to users.
+	Mentions     []*Mention `json:"mentions"`
+	Creator      *User      `json:"creator"`
+	CommentCount int        `json:"commentCount"`
+	RepostCount  int        `json:"repostCount"`
+	QuoteCount   int        `json:"quoteCount"`
+	// The post shared by a repost or quote post.
+	OriginalID *string `json:"originalId,omitempty"`
+	// Null when the original was deleted or is hidden from the authenticated user, though originalId is set.
+	Original *Post `json:"original,omitempty"`
+	// Whether the authenticated user saved the post.
+	Bookmarked bool `json:"bookmarked"`
+	// Counts of every reaction type, in a fixed order.
+	Reactions []*ReactionCount   `json:"reactions"`
+	CreatedAt string             `json:"createdAt"`
+	UpdatedAt string             `json:"updatedAt"`
+	Comments  *CommentConnection `json:"comments"`
 }
 
 type Query struct {
 }
 
+type ReactionCount struct {
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+}
+
 type User struct {
-	ID     string  `json:"_id"`
-	Email  string  `json:"email"`
-	Name   string  `json:"name"`
-	Status string  `json:"status"`
-	Posts  []*Post `json:"posts"`
+	ID string `json:"_id"`
+	// Only visible to the user themselves.
+	Email          *string `json:"email,omitempty"`
+	Name           string  `json:"name"`
+	Status         string  `json:"status"`
+	AvatarURL      *string `json:"avatarUrl,omitempty"`
+	BannerURL      *string `json:"bannerUrl,omitempty"`
+	PostCount      int     `json:"postCount"`
+	FollowerCount  int     `json:"followerCount"`
+	FollowingCount int     `json:"followingCount"`
+	CreatedAt      string  `json:"createdAt"`
+	Posts          []*Post `json:"posts"`
+	// Most recent followers first.
+	Followers []*User `json:"followers"`
+	// Most recently followed users first.
+	Following []*User `json:"following"`
 }
 
 type UserInputData struct {
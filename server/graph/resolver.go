@@ -7,7 +7,3 @@ import (
 type Resolver struct {
 	DB *mongo.Client
 }
-
-func (r *Resolver) Post() PostResolver {
-	return PostResolver{r}
-}
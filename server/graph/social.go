@@ -0,0 +1,93 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Jesuloba-world/social-sum/server/accesstoken"
+	"github.com/Jesuloba-world/social-sum/server/auth"
+	"github.com/Jesuloba-world/social-sum/server/graph/model"
+)
+
+// updateFollow adds or removes the authenticated user's follow of userID with change,
+// and returns the other user with their updated follower count.
+func updateFollow(ctx context.Context, userID string, change func(follower, followee primitive.ObjectID) (bool, error)) (*model.User, error) {
+	currentId, err := currentUserIdWithScope(ctx, accesstoken.ScopeFeedWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	followeeId, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id")
+	}
+
+	followee, err := auth.FindUser(followeeId)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := auth.FindUser(currentId)
+	if err != nil {
+		return nil, err
+	}
+
+	// blocked users are reported like unknown ones, so they can't tell they were blocked
+	if followee.HasBlocked(currentId) || current.HasBlocked(followeeId) {
+		return nil, auth.ErrUserNotFound
+	}
+
+	if _, err := change(currentId, followeeId); err != nil {
+		return nil, err
+	}
+
+	followee, err = auth.FindUser(followeeId)
+	if err != nil {
+		return nil, err
+	}
+
+	return toPublicUserModel(followee), nil
+}
+
+// listUsers resolves one page of a follower or following list with find. Users who blocked
+// the authenticated user are left out.
+func listUsers(ctx context.Context, obj *model.User, page, limit *int, find func(primitive.ObjectID, []primitive.ObjectID, int, int) ([]primitive.ObjectID, int64, error)) ([]*model.User, error) {
+	userId, err := primitive.ObjectIDFromHex(obj.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	blockedBy := []primitive.ObjectID{}
+	if currentId, err := currentUserId(ctx); err == nil {
+		blockedBy, err = auth.BlockedBy(currentId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pageNumber, pageSize := 1, 20
+	if page != nil {
+		pageNumber = *page
+	}
+	if limit != nil {
+		pageSize = *limit
+	}
+
+	ids, _, err := find(userId, blockedBy, pageNumber, pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch users: %s", err.Error())
+	}
+
+	users, err := auth.FindUsers(ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch users: %s", err.Error())
+	}
+
+	result := make([]*model.User, len(users))
+	for i := range users {
+		result[i] = toPublicUserModel(&users[i])
+	}
+	return result, nil
+}
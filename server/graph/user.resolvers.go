@@ -9,9 +9,13 @@ import (
 	"fmt"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 
 	"github.com/Jesuloba-world/social-sum/server/auth"
+	"github.com/Jesuloba-world/social-sum/server/feed"
 	"github.com/Jesuloba-world/social-sum/server/graph/model"
+	"github.com/Jesuloba-world/social-sum/server/rbac"
+	"github.com/Jesuloba-world/social-sum/server/social"
 )
 
 // CreateUser is the resolver for the createUser field.
@@ -19,7 +23,7 @@ func (r *mutationResolver) CreateUser(ctx context.Context, userInput model.UserI
 	// validate input
 	err := auth.ValidateSignupInput(auth.SignupInput{Email: userInput.Email, Name: userInput.Name, Password: userInput.Password})
 	if err != nil {
-		return nil, err
+		return nil, validationError(err)
 	}
 
 	userCollection := r.DB.Database("Auth").Collection("User")
@@ -34,6 +38,7 @@ func (r *mutationResolver) CreateUser(ctx context.Context, userInput model.UserI
 		Name:     userInput.Name,
 		Password: hashedPassword,
 		Status:   "I am new!",
+		Role:     rbac.RoleUser,
 	}
 
 	user.SetTimestamps()
@@ -52,21 +57,7 @@ func (r *mutationResolver) CreateUser(ctx context.Context, userInput model.UserI
 		return nil, fmt.Errorf("failed to fetch user: %s", err.Error())
 	}
 
-	var posts []*model.Post
-	for _, id := range createdUser.Posts {
-		post := &model.Post{
-			ID: id.Hex(),
-		}
-		posts = append(posts, post)
-	}
-
-	return &model.User{
-		ID:     createdUser.ID.Hex(),
-		Email:  createdUser.Email,
-		Name:   createdUser.Name,
-		Status: createdUser.Status,
-		Posts:  posts,
-	}, nil
+	return toUserModel(&createdUser), nil
 }
 
 // Hi is the resolver for the hi field.
@@ -74,7 +65,230 @@ func (r *mutationResolver) Hi(ctx context.Context, name string) (string, error)
 	panic(fmt.Errorf("not implemented: Hi - hi"))
 }
 
+// ChangePassword is the resolver for the changePassword field.
+func (r *mutationResolver) ChangePassword(ctx context.Context, currentPassword string, newPassword string) (bool, error) {
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	sessionId, err := currentSessionId(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	err = auth.ChangePassword(userId, sessionId, auth.ChangePasswordInput{CurrentPassword: currentPassword, NewPassword: newPassword})
+	if err != nil {
+		return false, validationError(err)
+	}
+
+	return true, nil
+}
+
+// ChangeEmail is the resolver for the changeEmail field.
+func (r *mutationResolver) ChangeEmail(ctx context.Context, newEmail string, password string) (bool, error) {
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := currentSessionId(ctx); err != nil {
+		return false, err
+	}
+
+	err = auth.RequestEmailChange(userId, auth.ChangeEmailInput{NewEmail: newEmail, Password: password})
+	if err != nil {
+		return false, validationError(err)
+	}
+
+	return true, nil
+}
+
+// ConfirmEmailChange is the resolver for the confirmEmailChange field.
+func (r *mutationResolver) ConfirmEmailChange(ctx context.Context, token string) (*model.User, error) {
+	user, err := auth.ConfirmEmailChange(token)
+	if err != nil {
+		return nil, validationError(err)
+	}
+
+	return toUserModel(user), nil
+}
+
+// UpdateName is the resolver for the updateName field.
+func (r *mutationResolver) UpdateName(ctx context.Context, name string) (*model.User, error) {
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := currentSessionId(ctx); err != nil {
+		return nil, err
+	}
+
+	user, err := auth.UpdateName(userId, auth.UpdateNameInput{Name: name})
+	if err != nil {
+		return nil, validationError(err)
+	}
+
+	return toUserModel(user), nil
+}
+
+// UpdateStatus is the resolver for the updateStatus field.
+func (r *mutationResolver) UpdateStatus(ctx context.Context, status string) (*model.User, error) {
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := currentSessionId(ctx); err != nil {
+		return nil, err
+	}
+
+	user, err := auth.UpdateStatus(userId, auth.UpdateStatusInput{Status: status})
+	if err != nil {
+		return nil, validationError(err)
+	}
+
+	return toUserModel(user), nil
+}
+
+// FollowUser is the resolver for the followUser field.
+func (r *mutationResolver) FollowUser(ctx context.Context, userID string) (*model.User, error) {
+	return updateFollow(ctx, userID, social.FollowUser)
+}
+
+// UnfollowUser is the resolver for the unfollowUser field.
+func (r *mutationResolver) UnfollowUser(ctx context.Context, userID string) (*model.User, error) {
+	return updateFollow(ctx, userID, social.UnfollowUser)
+}
+
+// Original is the resolver for the original field.
+func (r *postResolver) Original(ctx context.Context, obj *model.Post) (*model.Post, error) {
+	if obj.OriginalID == nil {
+		return nil, nil
+	}
+
+	originalId, err := primitive.ObjectIDFromHex(*obj.OriginalID)
+	if err != nil {
+		return nil, err
+	}
+
+	return originalPost(ctx, originalId)
+}
+
+// Bookmarked is the resolver for the bookmarked field.
+func (r *postResolver) Bookmarked(ctx context.Context, obj *model.Post) (bool, error) {
+	userId, err := currentUserId(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	postId, err := primitive.ObjectIDFromHex(obj.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return feed.IsBookmarked(userId, postId)
+}
+
+// Comments is the resolver for the comments field.
+func (r *postResolver) Comments(ctx context.Context, obj *model.Post, first *int, after *string) (*model.CommentConnection, error) {
+	postId, err := primitive.ObjectIDFromHex(obj.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return commentConnection(ctx, feed.PostComments(postId), first, after)
+}
+
+// User is the resolver for the user field.
+func (r *queryResolver) User(ctx context.Context, id *string) (*model.User, error) {
+	currentId, err := currentUserId(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userId := currentId
+	if id != nil {
+		userId, err = primitive.ObjectIDFromHex(*id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user id")
+		}
+	}
+
+	user, err := auth.FindUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	// reported like an unknown id, so the user can't tell they were blocked
+	if user.HasBlocked(currentId) {
+		return nil, auth.ErrUserNotFound
+	}
+
+	if user.ID == currentId {
+		return toUserModel(user), nil
+	}
+	return toPublicUserModel(user), nil
+}
+
+// Posts is the resolver for the posts field.
+func (r *userResolver) Posts(ctx context.Context, obj *model.User, page *int, limit *int) ([]*model.Post, error) {
+	userId, err := primitive.ObjectIDFromHex(obj.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// users who blocked the authenticated user show no posts to them
+	if currentId, err := currentUserId(ctx); err == nil {
+		owner, err := auth.FindUser(userId)
+		if err != nil {
+			return nil, err
+		}
+		if owner.HasBlocked(currentId) {
+			return []*model.Post{}, nil
+		}
+	}
+
+	pageNumber, pageSize := 1, 2
+	if page != nil {
+		pageNumber = *page
+	}
+	if limit != nil {
+		pageSize = *limit
+	}
+
+	posts, _, err := feed.FindPosts(bson.M{"creator": userId}, pageNumber, pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch posts: %s", err.Error())
+	}
+
+	result := make([]*model.Post, len(posts))
+	for i, post := range posts {
+		result[i] = toPostModel(post, obj)
+	}
+	return result, nil
+}
+
+// Followers is the resolver for the followers field.
+func (r *userResolver) Followers(ctx context.Context, obj *model.User, page *int, limit *int) ([]*model.User, error) {
+	return listUsers(ctx, obj, page, limit, social.Followers)
+}
+
+// Following is the resolver for the following field.
+func (r *userResolver) Following(ctx context.Context, obj *model.User, page *int, limit *int) ([]*model.User, error) {
+	return listUsers(ctx, obj, page, limit, social.Following)
+}
+
 // Mutation returns MutationResolver implementation.
 func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 
+// Post returns PostResolver implementation.
+func (r *Resolver) Post() PostResolver { return &postResolver{r} }
+
+// User returns UserResolver implementation.
+func (r *Resolver) User() UserResolver { return &userResolver{r} }
+
 type mutationResolver struct{ *Resolver }
+type postResolver struct{ *Resolver }
+type userResolver struct{ *Resolver }
@@ -0,0 +1,223 @@
+package imagestore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Uploads are stored under Dir, which main serves as /images.
+const (
+	Dir       = "./images"
+	URLPrefix = "images/"
+
+	// MaxSize matches fiber's default body limit.
+	MaxSize = 4 << 20
+	// maxPixels rejects images that are small files but decode to huge bitmaps.
+	maxPixels = 40_000_000
+)
+
+var (
+	ErrUnsupported = errors.New("image must be a JPEG, PNG, GIF or WebP")
+	ErrTooLarge    = fmt.Errorf("image must be at most %d MB", MaxSize>>20)
+)
+
+var extensions = map[string]string{
+	"jpeg": ".jpg",
+	"png":  ".png",
+	"gif":  ".gif",
+	"webp": ".webp",
+}
+
+// Variants maps the width of each stored size of an image to its URL.
+type Variants map[string]string
+
+// URL returns the narrowest variant at least width pixels wide, or the widest
+// variant if none is wide enough. It returns "" if there are no variants.
+func (v Variants) URL(width int) string {
+	best, bestWidth := "", 0
+	for name, url := range v {
+		w, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case best == "":
+			best, bestWidth = url, w
+		case bestWidth < width && w > bestWidth:
+			// still too narrow, anything wider is better
+			best, bestWidth = url, w
+		case w >= width && w < bestWidth:
+			best, bestWidth = url, w
+		}
+	}
+	return best
+}
+
+// Crop describes the variants made of an upload: the image is center cropped
+// to AspectWidth:AspectHeight, then scaled down to each of Widths.
+type Crop struct {
+	AspectWidth  int
+	AspectHeight int
+	Widths       []int
+}
+
+// read loads and validates an upload. The format is detected from the content, not the name.
+func read(file *multipart.FileHeader) ([]byte, string, error) {
+	if file.Size > MaxSize {
+		return nil, "", ErrTooLarge
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, MaxSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > MaxSize {
+		return nil, "", ErrTooLarge
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupported
+	}
+	if _, ok := extensions[format]; !ok {
+		return nil, "", ErrUnsupported
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, "", ErrTooLarge
+	}
+
+	return data, format, nil
+}
+
+func randomName() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Save validates an uploaded image and stores it unchanged under a random name.
+// It returns the image's URL.
+func Save(file *multipart.FileHeader) (string, error) {
+	data, format, err := read(file)
+	if err != nil {
+		return "", err
+	}
+
+	name, err := randomName()
+	if err != nil {
+		return "", err
+	}
+	name += extensions[format]
+
+	if err := os.WriteFile(filepath.Join(Dir, name), data, 0o644); err != nil {
+		return "", err
+	}
+
+	return URLPrefix + name, nil
+}
+
+// SaveCropped validates an uploaded image, and stores a JPEG of each variant described by crop.
+// Images are never scaled up, so variants of a small upload can be narrower than their name.
+func SaveCropped(file *multipart.FileHeader, crop Crop) (Variants, error) {
+	data, _, err := read(file)
+	if err != nil {
+		return nil, err
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+
+	area := centerCrop(src.Bounds(), crop.AspectWidth, crop.AspectHeight)
+
+	name, err := randomName()
+	if err != nil {
+		return nil, err
+	}
+
+	variants := Variants{}
+	for _, width := range crop.Widths {
+		w := min(width, area.Dx())
+		h := w * crop.AspectHeight / crop.AspectWidth
+
+		// JPEG has no transparency, so transparent pixels are drawn over white rather than black
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, area, draw.Over, nil)
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+			Remove(variants)
+			return nil, err
+		}
+
+		file := fmt.Sprintf("%s-%d.jpg", name, width)
+		if err := os.WriteFile(filepath.Join(Dir, file), buf.Bytes(), 0o644); err != nil {
+			Remove(variants)
+			return nil, err
+		}
+
+		variants[strconv.Itoa(width)] = URLPrefix + file
+	}
+
+	return variants, nil
+}
+
+// centerCrop returns the largest rectangle of the given aspect ratio centered in bounds.
+func centerCrop(bounds image.Rectangle, aspectWidth, aspectHeight int) image.Rectangle {
+	w, h := bounds.Dx(), bounds.Dy()
+
+	if w*aspectHeight > h*aspectWidth {
+		// too wide, trim the sides
+		cropWidth := h * aspectWidth / aspectHeight
+		x := bounds.Min.X + (w-cropWidth)/2
+		return image.Rect(x, bounds.Min.Y, x+cropWidth, bounds.Max.Y)
+	}
+
+	// too tall, trim top and bottom
+	cropHeight := w * aspectHeight / aspectWidth
+	y := bounds.Min.Y + (h-cropHeight)/2
+	return image.Rect(bounds.Min.X, y, bounds.Max.X, y+cropHeight)
+}
+
+// Remove deletes the stored files of every variant. Failures are only logged,
+// since a stray file shouldn't fail the request that replaced it.
+func Remove(variants Variants) {
+	for _, url := range variants {
+		if !strings.HasPrefix(url, URLPrefix) {
+			continue
+		}
+
+		path := filepath.Join(Dir, filepath.Base(url))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			slog.Error(fmt.Sprintf("could not remove image %s: %s", path, err.Error()))
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"fmt"
+	"log/slog"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// Send delivers a plain text email through the SMTP server in SMTP_HOST/SMTP_PORT,
+// authenticating with SMTP_USERNAME/SMTP_PASSWORD and sending from MAIL_FROM.
+// Without SMTP_HOST the email is only logged, which is enough for development.
+func Send(to, subject, body string) error {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		slog.Info(fmt.Sprintf("email to %s: %s\n%s", to, subject, body))
+		return nil
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	from := os.Getenv("MAIL_FROM")
+
+	var auth smtp.Auth
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+
+	message := strings.Join([]string{
+		"From: " + from,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	return smtp.SendMail(host+":"+port, auth, from, []string{to}, []byte(message))
+}
+
+// Link builds an absolute URL to path on this server, using APP_URL as the base.
+func Link(path string) string {
+	base := os.Getenv("APP_URL")
+	if base == "" {
+		base = "http://localhost:8000"
+	}
+	return strings.TrimSuffix(base, "/") + path
+}
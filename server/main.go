@@ -4,6 +4,7 @@ import (
 	"log"
 	"log/slog"
 	"net/http"
+	"strings"
 
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/playground"
@@ -14,11 +15,17 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/valyala/fasthttp/fasthttpadaptor"
 
+	"github.com/Jesuloba-world/social-sum/server/accesstoken"
 	"github.com/Jesuloba-world/social-sum/server/auth"
 	"github.com/Jesuloba-world/social-sum/server/database"
 	_ "github.com/Jesuloba-world/social-sum/server/docs"
 	"github.com/Jesuloba-world/social-sum/server/feed"
 	"github.com/Jesuloba-world/social-sum/server/graph"
+	"github.com/Jesuloba-world/social-sum/server/middleware"
+	"github.com/Jesuloba-world/social-sum/server/session"
+	"github.com/Jesuloba-world/social-sum/server/signing"
+	"github.com/Jesuloba-world/social-sum/server/social"
+	"github.com/Jesuloba-world/social-sum/server/users"
 )
 
 //	@title						Social sum API
@@ -31,6 +38,9 @@ import (
 //	@name						Authorization
 //	@security					[{"BearerAuth":[]}]
 
+// allowedOrigins may call the API with credentials and open the websocket with the jwt cookie.
+var allowedOrigins = []string{"http://localhost:5173", "https://altair-gql.sirmuel.design"}
+
 func wrapHandler(f func(http.ResponseWriter, *http.Request)) func(ctx *fiber.Ctx) {
 	return func(ctx *fiber.Ctx) {
 		fasthttpadaptor.NewFastHTTPHandler(http.HandlerFunc(f))(ctx.Context())
@@ -45,6 +55,10 @@ func main() {
 		log.Fatal("Error loading .env file")
 	}
 
+	if err := signing.Load(); err != nil {
+		log.Fatal(err)
+	}
+
 	app := fiber.New(fiber.Config{
 		Immutable: true,
 		// EnablePrintRoutes: true,
@@ -54,12 +68,34 @@ func main() {
 
 	defer disconnect()
 
+	if err := session.EnsureIndexes(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := accesstoken.EnsureIndexes(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := auth.EnsureIndexes(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := social.EnsureIndexes(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := feed.EnsureIndexes(); err != nil {
+		log.Fatal(err)
+	}
+
+	feed.StartTrending()
+
 	srv := handler.NewDefaultServer(graph.NewExecutableSchema(graph.Config{Resolvers: &graph.Resolver{
 		DB: database.Client,
 	}}))
 
-	// Serve GraphQL API
-	app.Post("/graphql", func(c *fiber.Ctx) error {
+	// Serve GraphQL API, resolvers read the authenticated user from the request context
+	app.Post("/graphql", middleware.IsAuthOptional, func(c *fiber.Ctx) error {
 		wrapHandler(srv.ServeHTTP)(c)
 		return nil
 	})
@@ -74,16 +110,19 @@ func main() {
 
 	app.Get("/swagger/*", swagger.HandlerDefault)
 
+	app.Get("/.well-known/jwks.json", signing.JWKSHandler)
+
 	app.Use(cors.New(cors.Config{
-		AllowOrigins:     "http://localhost:5173,https://altair-gql.sirmuel.design",
+		AllowOrigins:     strings.Join(allowedOrigins, ","),
 		AllowMethods:     "GET,POST,HEAD,PUT,DELETE,PATCH",
-		AllowHeaders:     "Content-Type, Authorization",
+		AllowHeaders:     "Content-Type, Authorization, X-CSRF-Token",
 		AllowCredentials: true,
 	}))
 
 	auth.Router(app)
 	feed.Router(app)
-	app.Get("/ws", websocket.New(feed.BroadcastHandler))
+	users.Router(app)
+	app.Get("/ws", middleware.WebsocketAuth(allowedOrigins), websocket.New(feed.BroadcastHandler))
 
 	app.Listen(":8000")
 }
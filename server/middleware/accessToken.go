@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Jesuloba-world/social-sum/server/accesstoken"
+	"github.com/Jesuloba-world/social-sum/server/database"
+)
+
+func authenticateAccessToken(c *fiber.Ctx, secret string) error {
+	token, err := accesstoken.Authenticate(secret)
+	if err != nil {
+		if err == accesstoken.ErrInvalid {
+			return c.Status(http.StatusUnauthorized).SendString("Invalid access token")
+		}
+		return c.Status(http.StatusInternalServerError).JSON(Error{Message: "An error occured", Error: err.Error()})
+	}
+
+	// the role isn't part of the token, so role changes apply immediately
+	user := struct {
+		Role string `bson:"role"`
+	}{}
+	userCollection := database.Client.Database("Auth").Collection("User")
+	opts := options.FindOne().SetProjection(bson.M{"role": 1})
+	err = userCollection.FindOne(context.TODO(), bson.M{"_id": token.UserID}, opts).Decode(&user)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).SendString("Invalid access token")
+	}
+
+	c.Locals("user_id", token.UserID.Hex())
+	c.Locals("role", user.Role)
+	c.Locals("token_id", token.ID.Hex())
+	c.Locals("scopes", token.Scopes)
+	c.Locals("auth_method", "access_token")
+	c.Locals("auth_expires_at", token.ExpiresAt)
+	return c.Next()
+}
+
+// RequireScope must run after IsAuth. Requests authenticated with a personal access
+// token need the given scope; requests from a login session have every scope.
+func RequireScope(scope accesstoken.Scope) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Locals("auth_method") != "access_token" {
+			return c.Next()
+		}
+
+		scopes, _ := c.Locals("scopes").([]accesstoken.Scope)
+		token := accesstoken.Token{Scopes: scopes}
+
+		if !token.HasScope(scope) {
+			return c.Status(http.StatusForbidden).JSON(Error{
+				Message: "Not authorized!",
+				Error:   "access token is missing scope " + string(scope),
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// RequireSession must run after IsAuth. It rejects personal access tokens,
+// for endpoints that manage the account itself.
+func RequireSession(c *fiber.Ctx) error {
+	if c.Locals("auth_method") != "session" {
+		return c.Status(http.StatusForbidden).JSON(Error{
+			Message: "Not authorized!",
+			Error:   "this endpoint requires a login session",
+		})
+	}
+
+	return c.Next()
+}
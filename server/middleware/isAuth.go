@@ -1,52 +1,84 @@
 package middleware
 
 import (
-	"fmt"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/Jesuloba-world/social-sum/server/accesstoken"
+	"github.com/Jesuloba-world/social-sum/server/session"
+	"github.com/Jesuloba-world/social-sum/server/signing"
 )
 
 func IsAuth(c *fiber.Ctx) error {
-	var secret_key = os.Getenv("SECRET_KEY")
 	authHeader := c.Get("Authorization")
 
 	var tokenString string
 
 	if authHeader != "" {
 		parts := strings.Split(authHeader, " ")
-		if len(parts) == 2 || parts[0] == "Bearer" {
+		if len(parts) == 2 && parts[0] == "Bearer" {
 			tokenString = parts[1]
 		}
 	}
 
+	// personal access tokens are only accepted in the header
+	if strings.HasPrefix(tokenString, accesstoken.Prefix) {
+		return authenticateAccessToken(c, tokenString)
+	}
+
 	if tokenString == "" {
 		tokenString = c.Cookies("jwt")
+
+		if tokenString != "" && !validCSRF(c) {
+			return sendCSRFError(c)
+		}
 	}
 
 	if tokenString == "" {
 		return c.Status(http.StatusUnauthorized).SendString("Token not found in Header or Cookie")
 	}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-
-		return []byte(secret_key), nil
-	})
+	token, err := signing.Parse(tokenString)
 
 	if err != nil {
 		return c.Status(http.StatusUnauthorized).JSON(Error{Message: "An error occured", Error: err.Error()})
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		userId, _ := claims["user_id"].(string)
+		sessionId, _ := claims["sid"].(string)
+
+		// the token is only as good as the session it was issued for
+		_, err := session.Validate(sessionId, userId)
+		if err != nil {
+			if err == session.ErrInvalid {
+				return c.Status(http.StatusUnauthorized).SendString("Session has expired or been revoked")
+			}
+			return c.Status(http.StatusInternalServerError).JSON(Error{Message: "An error occured", Error: err.Error()})
+		}
+
 		c.Locals("user_id", claims["user_id"])
+		c.Locals("role", claims["role"])
+		c.Locals("session_id", sessionId)
+		c.Locals("auth_method", "session")
+		if expiresAt, err := claims.GetExpirationTime(); err == nil && expiresAt != nil {
+			c.Locals("auth_expires_at", expiresAt.Time)
+		}
 		return c.Next()
 	}
 
 	return c.Status(http.StatusUnauthorized).SendString("Invalid token")
 }
+
+// IsAuthOptional authenticates requests that carry a token exactly like IsAuth,
+// and lets anonymous requests through without any user locals.
+func IsAuthOptional(c *fiber.Ctx) error {
+	if c.Get("Authorization") == "" && c.Cookies("jwt") == "" {
+		return c.Next()
+	}
+
+	return IsAuth(c)
+}
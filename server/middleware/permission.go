@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/Jesuloba-world/social-sum/server/rbac"
+)
+
+// GetRole returns the role IsAuth stored for the current request.
+// Tokens issued before roles existed carry no role and resolve to rbac.RoleUser.
+func GetRole(c *fiber.Ctx) rbac.Role {
+	role, _ := c.Locals("role").(string)
+
+	parsed, err := rbac.ParseRole(role)
+	if err != nil {
+		return rbac.RoleUser
+	}
+	return parsed
+}
+
+// RequirePermission must run after IsAuth. It rejects the request unless
+// the authenticated user's role grants every one of the given permissions.
+func RequirePermission(permissions ...rbac.Permission) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role := GetRole(c)
+
+		for _, permission := range permissions {
+			if !role.Can(permission) {
+				return c.Status(http.StatusForbidden).JSON(Error{
+					Message: "Not authorized!",
+					Error:   "missing permission " + string(permission),
+				})
+			}
+		}
+
+		return c.Next()
+	}
+}
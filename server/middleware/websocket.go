@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Browsers can't set headers on a websocket upgrade, so clients that don't rely on the
+// jwt cookie first exchange their token for a ticket and pass it as ?ticket=.
+// The ticket ends up in URLs and logs, so it is single use and short-lived.
+const wsTicketExpiry = 30 * time.Second
+
+// authLocals are the locals IsAuth may set, carried over from the ticket request to the upgrade.
+var authLocals = []string{"user_id", "role", "session_id", "token_id", "scopes", "auth_method", "auth_expires_at"}
+
+type wsTicket struct {
+	locals    map[string]interface{}
+	expiresAt time.Time
+}
+
+var wsTickets = struct {
+	sync.Mutex
+	tickets map[string]wsTicket
+}{tickets: make(map[string]wsTicket)}
+
+// IssueWebsocketTicket must run after IsAuth. It returns a ticket that authenticates
+// one websocket upgrade as the current user, and when it expires.
+func IssueWebsocketTicket(c *fiber.Ctx) (string, time.Time, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, err
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(buf)
+
+	locals := make(map[string]interface{}, len(authLocals))
+	for _, key := range authLocals {
+		if value := c.Locals(key); value != nil {
+			locals[key] = value
+		}
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(wsTicketExpiry)
+
+	wsTickets.Lock()
+	defer wsTickets.Unlock()
+
+	for key, t := range wsTickets.tickets {
+		if now.After(t.expiresAt) {
+			delete(wsTickets.tickets, key)
+		}
+	}
+	wsTickets.tickets[ticket] = wsTicket{locals: locals, expiresAt: expiresAt}
+
+	return ticket, expiresAt, nil
+}
+
+func redeemWebsocketTicket(ticket string) (wsTicket, bool) {
+	wsTickets.Lock()
+	defer wsTickets.Unlock()
+
+	t, ok := wsTickets.tickets[ticket]
+	delete(wsTickets.tickets, ticket)
+
+	if !ok || time.Now().After(t.expiresAt) {
+		return wsTicket{}, false
+	}
+	return t, true
+}
+
+// WebsocketAuth authenticates websocket upgrades with a ticket from IssueWebsocketTicket,
+// or with the same header or cookie IsAuth accepts. Cookie-authenticated upgrades must
+// come from one of allowedOrigins, since CORS and CSRF tokens don't apply to websockets.
+func WebsocketAuth(allowedOrigins []string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !websocket.IsWebSocketUpgrade(c) {
+			return fiber.ErrUpgradeRequired
+		}
+
+		if ticket := c.Query("ticket"); ticket != "" {
+			t, ok := redeemWebsocketTicket(ticket)
+			if !ok {
+				return c.Status(http.StatusUnauthorized).SendString("Invalid or expired websocket ticket")
+			}
+
+			for key, value := range t.locals {
+				c.Locals(key, value)
+			}
+			return c.Next()
+		}
+
+		// non-browser clients may leave out the origin, but they can't be tricked into sending a cookie either
+		origin := c.Get("Origin")
+		if c.Get("Authorization") == "" && origin != "" && !slices.Contains(allowedOrigins, origin) {
+			return c.Status(http.StatusForbidden).JSON(Error{
+				Message: "Not authorized!",
+				Error:   "websocket origin not allowed: " + origin,
+			})
+		}
+
+		return IsAuth(c)
+	}
+}
@@ -0,0 +1,143 @@
+package passwordhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hashes are stored in the PHC string format, which records the algorithm,
+// its version and its parameters next to the salt and the hash:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+//
+// bcrypt hashes ($2a$, $2b$, $2y$) from before Argon2id still verify,
+// but always report that they need rehashing.
+
+var ErrUnknownFormat = errors.New("unknown password hash format")
+
+type Params struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+var (
+	current     Params
+	currentOnce sync.Once
+)
+
+// CurrentParams returns the parameters new hashes are made with, read on first use from
+// ARGON2_MEMORY_KIB, ARGON2_ITERATIONS and ARGON2_PARALLELISM. The defaults follow the
+// second recommended option of RFC 9106 with a lower memory cost.
+func CurrentParams() Params {
+	currentOnce.Do(func() {
+		current = Params{
+			Memory:      uint32(envUint("ARGON2_MEMORY_KIB", 64*1024, 32)),
+			Iterations:  uint32(envUint("ARGON2_ITERATIONS", 3, 32)),
+			Parallelism: uint8(envUint("ARGON2_PARALLELISM", 2, 8)),
+			SaltLength:  16,
+			KeyLength:   32,
+		}
+	})
+	return current
+}
+
+func envUint(name string, fallback uint64, bits int) uint64 {
+	value, err := strconv.ParseUint(os.Getenv(name), 10, bits)
+	if err != nil || value == 0 {
+		return fallback
+	}
+	return value
+}
+
+// Hash hashes the password with Argon2id and the current parameters.
+func Hash(password string) (string, error) {
+	params := CurrentParams()
+
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.Memory, params.Iterations, params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify reports whether the password matches the encoded hash, and whether the hash
+// should be replaced because it uses an outdated algorithm or parameters.
+func Verify(encoded, password string) (match bool, needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return verifyArgon2id(encoded, password)
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		return true, true, nil
+	default:
+		return false, false, ErrUnknownFormat
+	}
+}
+
+func verifyArgon2id(encoded, password string) (bool, bool, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, false, ErrUnknownFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return false, false, ErrUnknownFormat
+	}
+	if version != argon2.Version {
+		return false, false, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	var params Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return false, false, ErrUnknownFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, ErrUnknownFormat
+	}
+
+	hash, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, ErrUnknownFormat
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(hash))
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, hash) != 1 {
+		return false, false, nil
+	}
+
+	return true, params != CurrentParams(), nil
+}
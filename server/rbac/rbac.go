@@ -0,0 +1,61 @@
+package rbac
+
+import "fmt"
+
+type Role string
+
+type Permission string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+const (
+	PermissionEditAnyPost   Permission = "post:edit:any"
+	PermissionDeleteAnyPost Permission = "post:delete:any"
+	PermissionManageRoles   Permission = "user:role:manage"
+	PermissionViewAuditLog  Permission = "audit:read"
+	PermissionUnlockLogins  Permission = "login:unlock"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleUser: {},
+	RoleModerator: {
+		PermissionEditAnyPost,
+		PermissionDeleteAnyPost,
+	},
+	RoleAdmin: {
+		PermissionEditAnyPost,
+		PermissionDeleteAnyPost,
+		PermissionManageRoles,
+		PermissionViewAuditLog,
+		PermissionUnlockLogins,
+	},
+}
+
+// ParseRole converts a stored or claimed role into a Role.
+// Users created before roles existed have no role and are treated as RoleUser.
+func ParseRole(role string) (Role, error) {
+	if role == "" {
+		return RoleUser, nil
+	}
+	if _, ok := rolePermissions[Role(role)]; !ok {
+		return "", fmt.Errorf("unknown role: %s", role)
+	}
+	return Role(role), nil
+}
+
+func (r Role) Permissions() []Permission {
+	return rolePermissions[r]
+}
+
+func (r Role) Can(permission Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,220 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Jesuloba-world/social-sum/server/database"
+)
+
+// lastSeenInterval limits how often a session's LastSeenAt is written,
+// so authenticated requests don't each cost a database write.
+const lastSeenInterval = time.Minute
+
+var ErrInvalid = errors.New("session is invalid, expired or revoked")
+
+// Session is the server-side record of one login.
+type Session struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	UserID     primitive.ObjectID `bson:"userId" json:"userId"`
+	UserAgent  string             `bson:"userAgent" json:"userAgent"`
+	IP         string             `bson:"ip" json:"ip"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	LastSeenAt time.Time          `bson:"lastSeenAt" json:"lastSeenAt"`
+	ExpiresAt  time.Time          `bson:"expiresAt" json:"expiresAt"`
+	RevokedAt  *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+}
+
+func collection() *mongo.Collection {
+	return database.Client.Database("Auth").Collection("Session")
+}
+
+// EnsureIndexes creates the lookup index and lets mongo remove sessions once they expire.
+func EnsureIndexes() error {
+	_, err := collection().Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "lastSeenAt", Value: -1}}},
+		{Keys: bson.M{"expiresAt": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+func Create(userId primitive.ObjectID, userAgent, ip string, expiresAt time.Time) (*Session, error) {
+	now := time.Now()
+
+	session := &Session{
+		UserID:     userId,
+		UserAgent:  userAgent,
+		IP:         ip,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  expiresAt,
+	}
+
+	result, err := collection().InsertOne(context.TODO(), session)
+	if err != nil {
+		return nil, err
+	}
+
+	session.ID = result.InsertedID.(primitive.ObjectID)
+	return session, nil
+}
+
+// Validate returns the session if it belongs to the user and is neither expired nor revoked.
+// It also records the request as the session's latest activity.
+func Validate(sessionId, userId string) (*Session, error) {
+	sessionObjectId, err := primitive.ObjectIDFromHex(sessionId)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+
+	userObjectId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+
+	now := time.Now()
+
+	filter := bson.M{
+		"_id":       sessionObjectId,
+		"userId":    userObjectId,
+		"revokedAt": bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": now},
+	}
+
+	session := new(Session)
+	err = collection().FindOne(context.TODO(), filter).Decode(session)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInvalid
+		}
+		return nil, err
+	}
+
+	if now.Sub(session.LastSeenAt) > lastSeenInterval {
+		session.LastSeenAt = now
+		_, err = collection().UpdateOne(context.TODO(), bson.M{"_id": session.ID}, bson.M{"$set": bson.M{"lastSeenAt": now}})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return session, nil
+}
+
+// List returns the user's active sessions, most recently used first.
+func List(userId primitive.ObjectID) ([]Session, error) {
+	filter := bson.M{
+		"userId":    userId,
+		"revokedAt": bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "lastSeenAt", Value: -1}})
+
+	cursor, err := collection().Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	sessions := []Session{}
+	if err := cursor.All(context.TODO(), &sessions); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Revoke revokes one of the user's sessions. It reports false if there was no such active session.
+func Revoke(userId, sessionId primitive.ObjectID) (bool, error) {
+	filter := bson.M{
+		"_id":       sessionId,
+		"userId":    userId,
+		"revokedAt": bson.M{"$exists": false},
+	}
+
+	result, err := collection().UpdateOne(context.TODO(), filter, bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+// RevokeAll revokes every active session of the user and returns how many were revoked.
+func RevokeAll(userId primitive.ObjectID) (int64, error) {
+	filter := bson.M{
+		"userId":    userId,
+		"revokedAt": bson.M{"$exists": false},
+	}
+
+	result, err := collection().UpdateMany(context.TODO(), filter, bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+// RevokeOthers revokes every active session of the user except the given one.
+func RevokeOthers(userId, keepSessionId primitive.ObjectID) (int64, error) {
+	filter := bson.M{
+		"_id":       bson.M{"$ne": keepSessionId},
+		"userId":    userId,
+		"revokedAt": bson.M{"$exists": false},
+	}
+
+	result, err := collection().UpdateMany(context.TODO(), filter, bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+func Find(sessionId primitive.ObjectID) (*Session, error) {
+	session := new(Session)
+	err := collection().FindOne(context.TODO(), bson.M{"_id": sessionId}).Decode(session)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInvalid
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+// Active returns which of the given sessions are neither expired nor revoked,
+// for checking many long-lived connections with one query.
+func Active(sessionIds []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	filter := bson.M{
+		"_id":       bson.M{"$in": sessionIds},
+		"revokedAt": bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}
+
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+
+	cursor, err := collection().Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	sessions := []Session{}
+	if err := cursor.All(context.TODO(), &sessions); err != nil {
+		return nil, err
+	}
+
+	active := make(map[primitive.ObjectID]bool, len(sessions))
+	for _, session := range sessions {
+		active[session.ID] = true
+	}
+	return active, nil
+}
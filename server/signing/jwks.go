@@ -0,0 +1,62 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+func (k *key) jwk() jwk {
+	result := jwk{Kid: k.id, Use: "sig", Alg: k.method.Alg()}
+
+	switch p := k.public.(type) {
+	case *rsa.PublicKey:
+		result.Kty = "RSA"
+		result.N = base64.RawURLEncoding.EncodeToString(p.N.Bytes())
+		result.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.E)).Bytes())
+	case ed25519.PublicKey:
+		result.Kty = "OKP"
+		result.Crv = "Ed25519"
+		result.X = base64.RawURLEncoding.EncodeToString(p)
+	}
+
+	return result
+}
+
+// @Summary		JSON Web Key Set
+// @Description	Public keys for verifying tokens issued by this server, including keys kept for rotation
+// @Tags			Auth
+// @Produce		json
+// @Success		200	{object}	jwkSet	"Key set"
+// @Router			/.well-known/jwks.json [get]
+func JWKSHandler(c *fiber.Ctx) error {
+	set := jwkSet{Keys: []jwk{}}
+	for _, id := range keys.ids() {
+		set.Keys = append(set.Keys, keys.keys[id].jwk())
+	}
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+
+	return c.Status(http.StatusOK).JSON(set)
+}
@@ -0,0 +1,241 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// key is one entry of the key set. Retired keys only have a public half:
+// they still verify tokens issued before a rotation but never sign new ones.
+type key struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+type keySet struct {
+	active *key
+	keys   map[string]*key
+	// legacySecret verifies HS256 tokens issued before the switch to asymmetric keys, until legacyUntil
+	legacySecret []byte
+	legacyUntil  time.Time
+}
+
+var keys *keySet
+
+// Load reads the signing keys. It must be called once, after the environment is loaded.
+//
+// JWT_KEYS_DIR holds one PEM file per key, named <kid>.pem. A file contains either a
+// private key (RSA or Ed25519, PKCS#8 or PKCS#1) or, for a retired key, only a public key.
+// JWT_ACTIVE_KEY_ID names the key new tokens are signed with. To rotate, add the new key,
+// wait for it to be picked up by every service reading the JWKS, switch JWT_ACTIVE_KEY_ID,
+// and remove the old file once the last token it signed has expired.
+//
+// Without JWT_KEYS_DIR an ephemeral Ed25519 key is generated, which is only fit for development.
+func Load() error {
+	set := &keySet{keys: make(map[string]*key)}
+
+	var err error
+	set.legacySecret, set.legacyUntil, err = loadLegacySecret()
+	if err != nil {
+		return err
+	}
+
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+
+		k := &key{id: "ephemeral", method: jwt.SigningMethodEdDSA, private: private, public: private.Public()}
+		set.keys[k.id] = k
+		set.active = k
+		keys = set
+
+		slog.Warn("JWT_KEYS_DIR is not set, signing tokens with an ephemeral key")
+		return nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		k, err := readKey(file)
+		if err != nil {
+			return fmt.Errorf("could not read signing key %s: %w", file, err)
+		}
+		set.keys[k.id] = k
+	}
+
+	activeId := os.Getenv("JWT_ACTIVE_KEY_ID")
+	active, ok := set.keys[activeId]
+	if !ok {
+		return fmt.Errorf("active signing key %q not found in %s", activeId, dir)
+	}
+	if active.private == nil {
+		return fmt.Errorf("active signing key %q has no private key", activeId)
+	}
+	set.active = active
+
+	keys = set
+	slog.Info(fmt.Sprintf("Loaded %d signing keys, signing with %s", len(set.keys), activeId))
+	return nil
+}
+
+// loadLegacySecret returns the secret HS256 tokens from before the switch to asymmetric keys
+// are verified with and the time they stop being accepted, or nil if they aren't accepted any more.
+//
+// They are only accepted when both SECRET_KEY and LEGACY_HS256_UNTIL are set. LEGACY_HS256_UNTIL is
+// an RFC 3339 time: set it to the switch plus the legacy token lifetime of an hour. Tokens expiring
+// after it, and any HS256 token once it has passed, are rejected, so the shared secret can't mint
+// tokens for longer than that. Once it has passed, unset both variables; the fallback itself will be
+// removed in a later release.
+func loadLegacySecret() ([]byte, time.Time, error) {
+	secret := os.Getenv("SECRET_KEY")
+	until := os.Getenv("LEGACY_HS256_UNTIL")
+	if secret == "" || until == "" {
+		if secret != "" {
+			slog.Warn("SECRET_KEY is set without LEGACY_HS256_UNTIL, HS256 tokens are rejected")
+		}
+		return nil, time.Time{}, nil
+	}
+
+	cutoff, err := time.Parse(time.RFC3339, until)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid LEGACY_HS256_UNTIL: %w", err)
+	}
+	if !time.Now().Before(cutoff) {
+		slog.Warn("LEGACY_HS256_UNTIL has passed, HS256 tokens are rejected; unset SECRET_KEY and LEGACY_HS256_UNTIL")
+		return nil, time.Time{}, nil
+	}
+
+	return []byte(secret), cutoff, nil
+}
+
+// legacyKey returns the secret for an HS256 token, if it is still accepted.
+func (s *keySet) legacyKey(token *jwt.Token) (interface{}, error) {
+	now := time.Now()
+	if !now.Before(s.legacyUntil) {
+		return nil, errors.New("HS256 tokens are no longer accepted")
+	}
+
+	// legacy tokens had no iat, but always an exp an hour after they were issued
+	expiresAt, err := token.Claims.GetExpirationTime()
+	if err != nil || expiresAt == nil || expiresAt.After(s.legacyUntil) {
+		return nil, errors.New("HS256 token outlives the legacy cutoff")
+	}
+
+	return s.legacySecret, nil
+}
+
+func readKey(file string) (*key, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	k := &key{id: strings.TrimSuffix(filepath.Base(file), ".pem")}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch p := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.private, k.public = p, &p.PublicKey
+	case ed25519.PrivateKey:
+		k.private, k.public = p, p.Public()
+	case *rsa.PublicKey, ed25519.PublicKey:
+		k.public = p
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	switch p := k.public.(type) {
+	case *rsa.PublicKey:
+		if p.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		k.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		k.method = jwt.SigningMethodEdDSA
+	}
+
+	return k, nil
+}
+
+// Sign signs the claims with the active key and sets the kid header.
+func Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(keys.active.method, claims)
+	token.Header["kid"] = keys.active.id
+
+	return token.SignedString(keys.active.private)
+}
+
+// Parse verifies a token against the key named by its kid header and returns it.
+func Parse(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, ok := token.Header["kid"].(string)
+		if !ok {
+			if keys.legacySecret != nil && token.Method == jwt.SigningMethodHS256 {
+				return keys.legacyKey(token)
+			}
+			return nil, errors.New("token has no kid header")
+		}
+
+		k, ok := keys.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key: %s", kid)
+		}
+
+		if token.Method.Alg() != k.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return k.public, nil
+	})
+}
+
+// ids returns the key ids in a stable order.
+func (s *keySet) ids() []string {
+	ids := make([]string, 0, len(s.keys))
+	for id := range s.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
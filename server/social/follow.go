@@ -0,0 +1,247 @@
+package social
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Jesuloba-world/social-sum/server/database"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var ErrSelfFollow = errors.New("users cannot follow themselves")
+
+// Follow is one edge of the social graph: FollowerID follows FolloweeID.
+type Follow struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	FollowerID primitive.ObjectID `bson:"followerId" json:"followerId"`
+	FolloweeID primitive.ObjectID `bson:"followeeId" json:"followeeId"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// FollowEvent is sent to listeners whenever an edge is added or removed.
+type FollowEvent struct {
+	FollowerID primitive.ObjectID
+	FolloweeID primitive.ObjectID
+	Following  bool
+}
+
+var followListeners []func(FollowEvent)
+
+// OnFollow registers a function called after every follow and unfollow.
+// Listeners are registered from init functions and must not block.
+func OnFollow(listener func(FollowEvent)) {
+	followListeners = append(followListeners, listener)
+}
+
+func notifyFollow(event FollowEvent) {
+	for _, listener := range followListeners {
+		listener(event)
+	}
+}
+
+func collection() *mongo.Collection {
+	return database.Client.Database("Social").Collection("Follow")
+}
+
+// EnsureIndexes makes each edge unique, and indexes both directions for the follower and following lists.
+func EnsureIndexes() error {
+	_, err := collection().Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "followerId", Value: 1}, {Key: "followeeId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "followerId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "followeeId", Value: 1}, {Key: "createdAt", Value: -1}}},
+	})
+	return err
+}
+
+// adjustCounts keeps the denormalized counts on both users in step with the edges. The edge
+// is written first and is the source of truth, so if an increment fails the counts of both
+// users are recomputed from the edges instead of being left off by one.
+func adjustCounts(followerId, followeeId primitive.ObjectID, delta int) error {
+	userCollection := database.Client.Database("Auth").Collection("User")
+
+	_, err := userCollection.UpdateByID(context.TODO(), followerId, bson.M{"$inc": bson.M{"followingCount": delta}})
+	if err == nil {
+		_, err = userCollection.UpdateByID(context.TODO(), followeeId, bson.M{"$inc": bson.M{"followerCount": delta}})
+	}
+	if err == nil {
+		return nil
+	}
+
+	if recountErr := recountFollows(followerId, followeeId); recountErr != nil {
+		return err
+	}
+	return nil
+}
+
+// recountFollows sets the following count of followerId and the follower count of followeeId
+// from the edges.
+func recountFollows(followerId, followeeId primitive.ObjectID) error {
+	userCollection := database.Client.Database("Auth").Collection("User")
+
+	following, err := collection().CountDocuments(context.TODO(), bson.M{"followerId": followerId})
+	if err != nil {
+		return err
+	}
+
+	followers, err := collection().CountDocuments(context.TODO(), bson.M{"followeeId": followeeId})
+	if err != nil {
+		return err
+	}
+
+	_, err = userCollection.UpdateByID(context.TODO(), followerId, bson.M{"$set": bson.M{"followingCount": following}})
+	if err != nil {
+		return err
+	}
+
+	_, err = userCollection.UpdateByID(context.TODO(), followeeId, bson.M{"$set": bson.M{"followerCount": followers}})
+	return err
+}
+
+// FollowUser makes followerId follow followeeId. Following someone twice is not an error,
+// created reports whether a new edge was added.
+func FollowUser(followerId, followeeId primitive.ObjectID) (created bool, err error) {
+	if followerId == followeeId {
+		return false, ErrSelfFollow
+	}
+
+	follow := Follow{FollowerID: followerId, FolloweeID: followeeId, CreatedAt: time.Now()}
+
+	_, err = collection().InsertOne(context.TODO(), follow)
+	if err != nil {
+		// the unique index makes concurrent follows safe, only one of them is counted
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if err := adjustCounts(followerId, followeeId, 1); err != nil {
+		return false, err
+	}
+
+	notifyFollow(FollowEvent{FollowerID: followerId, FolloweeID: followeeId, Following: true})
+
+	return true, nil
+}
+
+// UnfollowUser removes the edge, if there is one. removed reports whether there was.
+func UnfollowUser(followerId, followeeId primitive.ObjectID) (removed bool, err error) {
+	result, err := collection().DeleteOne(context.TODO(), bson.M{"followerId": followerId, "followeeId": followeeId})
+	if err != nil {
+		return false, err
+	}
+	if result.DeletedCount == 0 {
+		return false, nil
+	}
+
+	if err := adjustCounts(followerId, followeeId, -1); err != nil {
+		return false, err
+	}
+
+	notifyFollow(FollowEvent{FollowerID: followerId, FolloweeID: followeeId, Following: false})
+
+	return true, nil
+}
+
+// IsFollowing reports whether followerId follows followeeId.
+func IsFollowing(followerId, followeeId primitive.ObjectID) (bool, error) {
+	err := collection().FindOne(context.TODO(), bson.M{"followerId": followerId, "followeeId": followeeId}).Err()
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Followers returns one page of the ids of the users following userId, most recent first,
+// and the total number of followers. The users in exclude are left out. Pages start at 1.
+func Followers(userId primitive.ObjectID, exclude []primitive.ObjectID, page, limit int) ([]primitive.ObjectID, int64, error) {
+	filter := bson.M{"followeeId": userId, "followerId": bson.M{"$nin": exclude}}
+	return findEdges(filter, page, limit, func(follow Follow) primitive.ObjectID { return follow.FollowerID })
+}
+
+// Following returns one page of the ids of the users userId follows, most recent first,
+// and the total number of them. The users in exclude are left out. Pages start at 1.
+func Following(userId primitive.ObjectID, exclude []primitive.ObjectID, page, limit int) ([]primitive.ObjectID, int64, error) {
+	filter := bson.M{"followerId": userId, "followeeId": bson.M{"$nin": exclude}}
+	return findEdges(filter, page, limit, func(follow Follow) primitive.ObjectID { return follow.FolloweeID })
+}
+
+// FollowerIds returns the ids of every user following userId.
+func FollowerIds(userId primitive.ObjectID) ([]primitive.ObjectID, error) {
+	return allEdges(bson.M{"followeeId": userId}, func(follow Follow) primitive.ObjectID { return follow.FollowerID })
+}
+
+// FollowingIds returns the ids of every user userId follows.
+func FollowingIds(userId primitive.ObjectID) ([]primitive.ObjectID, error) {
+	return allEdges(bson.M{"followerId": userId}, func(follow Follow) primitive.ObjectID { return follow.FolloweeID })
+}
+
+func allEdges(filter bson.M, pick func(Follow) primitive.ObjectID) ([]primitive.ObjectID, error) {
+	cursor, err := collection().Find(context.TODO(), filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var follows []Follow
+	if err := cursor.All(context.TODO(), &follows); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, len(follows))
+	for i, follow := range follows {
+		ids[i] = pick(follow)
+	}
+	return ids, nil
+}
+
+// findEdges returns one page of the edges matching filter, as the user ids picked from each.
+func findEdges(filter bson.M, page, limit int, pick func(Follow) primitive.ObjectID) ([]primitive.ObjectID, int64, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	skip := (page - 1) * limit
+
+	opts := options.Find().SetLimit(int64(limit)).SetSkip(int64(skip)).SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	cursor, err := collection().Find(context.TODO(), filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var follows []Follow
+	if err := cursor.All(context.TODO(), &follows); err != nil {
+		return nil, 0, err
+	}
+
+	ids := make([]primitive.ObjectID, len(follows))
+	for i, follow := range follows {
+		ids[i] = pick(follow)
+	}
+
+	total, err := collection().CountDocuments(context.TODO(), filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return ids, total, nil
+}
@@ -0,0 +1,486 @@
+package users
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Jesuloba-world/social-sum/server/auth"
+	"github.com/Jesuloba-world/social-sum/server/feed"
+	"github.com/Jesuloba-world/social-sum/server/social"
+)
+
+type profileSerializer struct {
+	Message string  `json:"message"`
+	User    Profile `json:"user"`
+}
+
+type userPostsSerializer struct {
+	Message    string      `json:"message"`
+	Posts      []feed.Post `json:"posts"`
+	TotalItems int64       `json:"totalItems"`
+}
+
+type followSerializer struct {
+	Message       string `json:"message"`
+	Following     bool   `json:"following"`
+	FollowerCount int    `json:"followerCount"`
+}
+
+type userListSerializer struct {
+	Message    string    `json:"message"`
+	Users      []Profile `json:"users"`
+	TotalItems int64     `json:"totalItems"`
+}
+
+type blockSerializer struct {
+	Message string `json:"message"`
+	Blocked bool   `json:"blocked"`
+}
+
+type muteSerializer struct {
+	Message string `json:"message"`
+	Muted   bool   `json:"muted"`
+}
+
+var errInvalidId = errors.New("Invalid Id")
+
+// findUser loads the user named by the userId route parameter.
+// Users who blocked the authenticated user are reported as not found, so they can't tell they were blocked.
+func findUser(c *fiber.Ctx) (*auth.User, error) {
+	userId, err := primitive.ObjectIDFromHex(c.Params("userId"))
+	if err != nil {
+		return nil, errInvalidId
+	}
+
+	user, err := auth.FindUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	viewerId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return nil, err
+	}
+	if user.HasBlocked(viewerId) {
+		return nil, auth.ErrUserNotFound
+	}
+
+	return user, nil
+}
+
+func sendUserError(c *fiber.Ctx, err error) error {
+	switch err {
+	case errInvalidId:
+		return c.Status(http.StatusBadRequest).SendString(err.Error())
+	case auth.ErrUserNotFound:
+		return c.Status(http.StatusNotFound).SendString("User not found")
+	case social.ErrSelfFollow, auth.ErrSelfBlock:
+		return c.Status(http.StatusBadRequest).SendString(err.Error())
+	case auth.ErrListFull:
+		return c.Status(http.StatusUnprocessableEntity).SendString(err.Error())
+	}
+
+	return c.Status(http.StatusInternalServerError).SendString(err.Error())
+}
+
+// @Summary		Get a user's profile
+// @Description	Fetches the public profile of a user
+// @Tags			Users
+// @Produce		json
+// @Security		BearerAuth
+// @Param			userId	path		string				true	"User ID"
+// @Success		200		{object}	profileSerializer	"Successfully fetched user"
+// @Failure		400		{string}	string				"Bad Request"
+// @Failure		401		{string}	string				"Unauthorized"
+// @Failure		404		{string}	string				"Not Found"
+// @Failure		500		{string}	string				"Internal Server Error"
+// @Router			/users/{userId} [get]
+func getProfile(c *fiber.Ctx) error {
+	user, err := findUser(c)
+	if err != nil {
+		return sendUserError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(profileSerializer{Message: "User fetched successfully", User: NewProfile(user)})
+}
+
+// @Summary		Get a user's posts
+// @Description	Fetches the posts of a user with pagination
+// @Tags			Users
+// @Produce		json
+// @Security		BearerAuth
+// @Param			userId	path		string				true	"User ID"
+// @Param			page	query		int					false	"Page number"
+// @Param			limit	query		int					false	"Number of posts per page"
+// @Success		200		{object}	userPostsSerializer	"Successfully fetched posts"
+// @Failure		400		{string}	string				"Bad Request"
+// @Failure		401		{string}	string				"Unauthorized"
+// @Failure		404		{string}	string				"Not Found"
+// @Failure		500		{string}	string				"Internal Server Error"
+// @Router			/users/{userId}/posts [get]
+func getUserPosts(c *fiber.Ctx) error {
+	user, err := findUser(c)
+	if err != nil {
+		return sendUserError(c, err)
+	}
+
+	viewerId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).SendString(err.Error())
+	}
+
+	viewer, err := auth.FindUser(viewerId)
+	if err != nil {
+		return sendUserError(c, err)
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "2"))
+
+	posts, total, err := feed.FindUserPosts(viewer, user.ID, page, limit)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(http.StatusOK).JSON(userPostsSerializer{Message: "Posts fetched successfully", Posts: posts, TotalItems: total})
+}
+
+// @Summary		Follow a user
+// @Description	Makes the authenticated user follow a user. Following a user twice has no effect
+// @Tags			Users
+// @Produce		json
+// @Security		BearerAuth
+// @Param			userId	path		string				true	"User ID"
+// @Success		200		{object}	followSerializer	"Successfully followed user"
+// @Failure		400		{string}	string				"Bad Request"
+// @Failure		401		{string}	string				"Unauthorized"
+// @Failure		404		{string}	string				"Not Found"
+// @Failure		500		{string}	string				"Internal Server Error"
+// @Router			/users/{userId}/follow [post]
+func followUser(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).SendString(err.Error())
+	}
+
+	followee, err := findUser(c)
+	if err != nil {
+		return sendUserError(c, err)
+	}
+
+	follower, err := auth.FindUser(userId)
+	if err != nil {
+		return sendUserError(c, err)
+	}
+	if follower.HasBlocked(followee.ID) {
+		return sendUserError(c, auth.ErrUserNotFound)
+	}
+
+	if _, err := social.FollowUser(userId, followee.ID); err != nil {
+		return sendUserError(c, err)
+	}
+
+	return sendFollowState(c, followee.ID, "User followed successfully", true)
+}
+
+// @Summary		Unfollow a user
+// @Description	Makes the authenticated user stop following a user
+// @Tags			Users
+// @Produce		json
+// @Security		BearerAuth
+// @Param			userId	path		string				true	"User ID"
+// @Success		200		{object}	followSerializer	"Successfully unfollowed user"
+// @Failure		400		{string}	string				"Bad Request"
+// @Failure		401		{string}	string				"Unauthorized"
+// @Failure		404		{string}	string				"Not Found"
+// @Failure		500		{string}	string				"Internal Server Error"
+// @Router			/users/{userId}/follow [delete]
+func unfollowUser(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).SendString(err.Error())
+	}
+
+	followee, err := findUser(c)
+	if err != nil {
+		return sendUserError(c, err)
+	}
+
+	if _, err := social.UnfollowUser(userId, followee.ID); err != nil {
+		return sendUserError(c, err)
+	}
+
+	return sendFollowState(c, followee.ID, "User unfollowed successfully", false)
+}
+
+// sendFollowState responds with the followee's follower count, reloaded so it includes the change just made.
+func sendFollowState(c *fiber.Ctx, followeeId primitive.ObjectID, message string, following bool) error {
+	followee, err := auth.FindUser(followeeId)
+	if err != nil {
+		return sendUserError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(followSerializer{Message: message, Following: following, FollowerCount: followee.FollowerCount})
+}
+
+// @Summary		Get a user's followers
+// @Description	Fetches the users following a user, most recent first, with pagination
+// @Tags			Users
+// @Produce		json
+// @Security		BearerAuth
+// @Param			userId	path		string				true	"User ID"
+// @Param			page	query		int					false	"Page number"
+// @Param			limit	query		int					false	"Number of users per page"
+// @Success		200		{object}	userListSerializer	"Successfully fetched followers"
+// @Failure		400		{string}	string				"Bad Request"
+// @Failure		401		{string}	string				"Unauthorized"
+// @Failure		404		{string}	string				"Not Found"
+// @Failure		500		{string}	string				"Internal Server Error"
+// @Router			/users/{userId}/followers [get]
+func getFollowers(c *fiber.Ctx) error {
+	return sendUserList(c, social.Followers, "Followers fetched successfully")
+}
+
+// @Summary		Get the users a user follows
+// @Description	Fetches the users a user follows, most recent first, with pagination
+// @Tags			Users
+// @Produce		json
+// @Security		BearerAuth
+// @Param			userId	path		string				true	"User ID"
+// @Param			page	query		int					false	"Page number"
+// @Param			limit	query		int					false	"Number of users per page"
+// @Success		200		{object}	userListSerializer	"Successfully fetched followed users"
+// @Failure		400		{string}	string				"Bad Request"
+// @Failure		401		{string}	string				"Unauthorized"
+// @Failure		404		{string}	string				"Not Found"
+// @Failure		500		{string}	string				"Internal Server Error"
+// @Router			/users/{userId}/following [get]
+func getFollowing(c *fiber.Ctx) error {
+	return sendUserList(c, social.Following, "Followed users fetched successfully")
+}
+
+// sendUserList responds with one page of the users listed by find for the user in the route.
+// Users who blocked the authenticated user are left out.
+func sendUserList(c *fiber.Ctx, find func(primitive.ObjectID, []primitive.ObjectID, int, int) ([]primitive.ObjectID, int64, error), message string) error {
+	user, err := findUser(c)
+	if err != nil {
+		return sendUserError(c, err)
+	}
+
+	viewerId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).SendString(err.Error())
+	}
+
+	blockedBy, err := auth.BlockedBy(viewerId)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
+
+	ids, total, err := find(user.ID, blockedBy, page, limit)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	users, err := auth.FindUsers(ids)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(http.StatusOK).JSON(userListSerializer{Message: message, Users: newProfiles(users), TotalItems: total})
+}
+
+// findTarget loads the user named by the userId route parameter for blocking or muting.
+// Unlike findUser, it finds users who blocked the authenticated user, who can still be blocked back.
+func findTarget(c *fiber.Ctx) (*auth.User, error) {
+	userId, err := primitive.ObjectIDFromHex(c.Params("userId"))
+	if err != nil {
+		return nil, errInvalidId
+	}
+
+	return auth.FindUser(userId)
+}
+
+// @Summary		Block a user
+// @Description	Blocks a user, who can no longer see or interact with the authenticated user's posts. Follows between the two users are removed
+// @Tags			Users
+// @Produce		json
+// @Security		BearerAuth
+// @Param			userId	path		string			true	"User ID"
+// @Success		200		{object}	blockSerializer	"Successfully blocked user"
+// @Failure		400		{string}	string			"Bad Request"
+// @Failure		401		{string}	string			"Unauthorized"
+// @Failure		404		{string}	string			"Not Found"
+// @Failure		422		{string}	string			"Block list is full"
+// @Failure		500		{string}	string			"Internal Server Error"
+// @Router			/users/{userId}/block [post]
+func blockUser(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).SendString(err.Error())
+	}
+
+	target, err := findTarget(c)
+	if err != nil {
+		return sendUserError(c, err)
+	}
+
+	if _, err := auth.BlockUser(userId, target.ID); err != nil {
+		return sendUserError(c, err)
+	}
+
+	// neither user follows the other once blocked
+	if _, err := social.UnfollowUser(userId, target.ID); err != nil {
+		return sendUserError(c, err)
+	}
+	if _, err := social.UnfollowUser(target.ID, userId); err != nil {
+		return sendUserError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(blockSerializer{Message: "User blocked successfully", Blocked: true})
+}
+
+// @Summary		Unblock a user
+// @Description	Removes a user from the authenticated user's block list
+// @Tags			Users
+// @Produce		json
+// @Security		BearerAuth
+// @Param			userId	path		string			true	"User ID"
+// @Success		200		{object}	blockSerializer	"Successfully unblocked user"
+// @Failure		400		{string}	string			"Bad Request"
+// @Failure		401		{string}	string			"Unauthorized"
+// @Failure		404		{string}	string			"Not Found"
+// @Failure		500		{string}	string			"Internal Server Error"
+// @Router			/users/{userId}/block [delete]
+func unblockUser(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).SendString(err.Error())
+	}
+
+	target, err := findTarget(c)
+	if err != nil {
+		return sendUserError(c, err)
+	}
+
+	if _, err := auth.UnblockUser(userId, target.ID); err != nil {
+		return sendUserError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(blockSerializer{Message: "User unblocked successfully", Blocked: false})
+}
+
+// @Summary		Mute a user
+// @Description	Hides a user's posts from the authenticated user's feed, timeline and live updates
+// @Tags			Users
+// @Produce		json
+// @Security		BearerAuth
+// @Param			userId	path		string			true	"User ID"
+// @Success		200		{object}	muteSerializer	"Successfully muted user"
+// @Failure		400		{string}	string			"Bad Request"
+// @Failure		401		{string}	string			"Unauthorized"
+// @Failure		404		{string}	string			"Not Found"
+// @Failure		422		{string}	string			"Mute list is full"
+// @Failure		500		{string}	string			"Internal Server Error"
+// @Router			/users/{userId}/mute [post]
+func muteUser(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).SendString(err.Error())
+	}
+
+	target, err := findTarget(c)
+	if err != nil {
+		return sendUserError(c, err)
+	}
+
+	if _, err := auth.MuteUser(userId, target.ID); err != nil {
+		return sendUserError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(muteSerializer{Message: "User muted successfully", Muted: true})
+}
+
+// @Summary		Unmute a user
+// @Description	Removes a user from the authenticated user's mute list
+// @Tags			Users
+// @Produce		json
+// @Security		BearerAuth
+// @Param			userId	path		string			true	"User ID"
+// @Success		200		{object}	muteSerializer	"Successfully unmuted user"
+// @Failure		400		{string}	string			"Bad Request"
+// @Failure		401		{string}	string			"Unauthorized"
+// @Failure		404		{string}	string			"Not Found"
+// @Failure		500		{string}	string			"Internal Server Error"
+// @Router			/users/{userId}/mute [delete]
+func unmuteUser(c *fiber.Ctx) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).SendString(err.Error())
+	}
+
+	target, err := findTarget(c)
+	if err != nil {
+		return sendUserError(c, err)
+	}
+
+	if _, err := auth.UnmuteUser(userId, target.ID); err != nil {
+		return sendUserError(c, err)
+	}
+
+	return c.Status(http.StatusOK).JSON(muteSerializer{Message: "User unmuted successfully", Muted: false})
+}
+
+// @Summary		Get blocked users
+// @Description	Fetches the users the authenticated user blocked
+// @Tags			Users
+// @Produce		json
+// @Security		BearerAuth
+// @Success		200	{object}	userListSerializer	"Successfully fetched blocked users"
+// @Failure		401	{string}	string				"Unauthorized"
+// @Failure		500	{string}	string				"Internal Server Error"
+// @Router			/users/blocked [get]
+func getBlocked(c *fiber.Ctx) error {
+	return sendOwnList(c, func(user *auth.User) []primitive.ObjectID { return user.Blocked }, "Blocked users fetched successfully")
+}
+
+// @Summary		Get muted users
+// @Description	Fetches the users the authenticated user muted
+// @Tags			Users
+// @Produce		json
+// @Security		BearerAuth
+// @Success		200	{object}	userListSerializer	"Successfully fetched muted users"
+// @Failure		401	{string}	string				"Unauthorized"
+// @Failure		500	{string}	string				"Internal Server Error"
+// @Router			/users/muted [get]
+func getMuted(c *fiber.Ctx) error {
+	return sendOwnList(c, func(user *auth.User) []primitive.ObjectID { return user.Muted }, "Muted users fetched successfully")
+}
+
+// sendOwnList responds with the users in one of the authenticated user's lists.
+func sendOwnList(c *fiber.Ctx, list func(*auth.User) []primitive.ObjectID, message string) error {
+	userId, err := getUserIdFromLocals(c)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).SendString(err.Error())
+	}
+
+	user, err := auth.FindUser(userId)
+	if err != nil {
+		return sendUserError(c, err)
+	}
+
+	ids := list(user)
+	users, err := auth.FindUsers(ids)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.Status(http.StatusOK).JSON(userListSerializer{Message: message, Users: newProfiles(users), TotalItems: int64(len(users))})
+}
@@ -0,0 +1,16 @@
+package users
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func getUserIdFromLocals(c *fiber.Ctx) (primitive.ObjectID, error) {
+	userId, ok := c.Locals("user_id").(string)
+	if !ok {
+		return primitive.ObjectID{}, fmt.Errorf("user not found")
+	}
+	return primitive.ObjectIDFromHex(userId)
+}
@@ -0,0 +1,45 @@
+package users
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Jesuloba-world/social-sum/server/auth"
+	"github.com/Jesuloba-world/social-sum/server/imagestore"
+)
+
+// Profile is what any authenticated user can see of another user.
+type Profile struct {
+	ID             primitive.ObjectID  `json:"_id"`
+	Name           string              `json:"name"`
+	Status         string              `json:"status"`
+	Avatar         imagestore.Variants `json:"avatar,omitempty"`
+	Banner         imagestore.Variants `json:"banner,omitempty"`
+	PostCount      int                 `json:"postCount"`
+	FollowerCount  int                 `json:"followerCount"`
+	FollowingCount int                 `json:"followingCount"`
+	CreatedAt      time.Time           `json:"createdAt"`
+}
+
+func NewProfile(user *auth.User) Profile {
+	return Profile{
+		ID:             user.ID,
+		Name:           user.Name,
+		Status:         user.Status,
+		Avatar:         user.Avatar,
+		Banner:         user.Banner,
+		PostCount:      len(user.Posts),
+		FollowerCount:  user.FollowerCount,
+		FollowingCount: user.FollowingCount,
+		CreatedAt:      user.CreatedAt,
+	}
+}
+
+func newProfiles(users []auth.User) []Profile {
+	profiles := make([]Profile, len(users))
+	for i := range users {
+		profiles[i] = NewProfile(&users[i])
+	}
+	return profiles
+}
@@ -0,0 +1,28 @@
+package users
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/Jesuloba-world/social-sum/server/accesstoken"
+	"github.com/Jesuloba-world/social-sum/server/middleware"
+)
+
+func Router(app *fiber.App) {
+	read := middleware.RequireScope(accesstoken.ScopeFeedRead)
+	write := middleware.RequireScope(accesstoken.ScopeFeedWrite)
+
+	api := app.Group("/users", middleware.IsAuth)
+	// registered before /:userId, which would otherwise match them
+	api.Get("/blocked", read, getBlocked)
+	api.Get("/muted", read, getMuted)
+	api.Get("/:userId", read, getProfile)
+	api.Get("/:userId/posts", read, getUserPosts)
+	api.Get("/:userId/followers", read, getFollowers)
+	api.Get("/:userId/following", read, getFollowing)
+	api.Post("/:userId/follow", write, followUser)
+	api.Delete("/:userId/follow", write, unfollowUser)
+	api.Post("/:userId/block", write, blockUser)
+	api.Delete("/:userId/block", write, unblockUser)
+	api.Post("/:userId/mute", write, muteUser)
+	api.Delete("/:userId/mute", write, unmuteUser)
+}